@@ -1,23 +1,72 @@
 package benchmark
 
 import (
-	"log"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
 	"math"
 	"math/rand"
-	"os"
-	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
+
+	"github.com/RomanBoegli/godbbench/statement"
 )
 
 // Bencher is the interface a benchmark has to impelement.
+// Exec has to return as soon as possible once the given context is done.
+// Cleanup removes the benchmarking data and optionally closes the connection,
+// Close only closes it, leaving the data as it is.
 type Bencher interface {
-	Setup()
+	Setup() error
 	Cleanup(bool)
+	Close()
 	Benchmarks() []Benchmark
-	Exec(string)
+	Exec(context.Context, string) error
+}
+
+// VersionBencher is implemented by benchers which can tell the version of the database
+// server, it is part of the JSON report of a run.
+type VersionBencher interface {
+	Bencher
+	ServerVersion(ctx context.Context) (string, error)
+}
+
+// DialectBencher is implemented by benchers which know the query language of their
+// database, it selects the \dialect sections of a script, see ParseOptions.
+type DialectBencher interface {
+	Bencher
+	// Dialect returns the name of the query language, see statement.Dialects.
+	Dialect() string
+}
+
+// DialectOf returns the name of the query language of a bencher, or an empty string
+// if it is unknown.
+func DialectOf(bencher Bencher) string {
+	if d, ok := bencher.(DialectBencher); ok {
+		return d.Dialect()
+	}
+	return ""
+}
+
+// PreparedBencher is implemented by benchers which can execute prepared statements
+// with bound parameters, see Options.Prepared.
+type PreparedBencher interface {
+	Bencher
+	// Placeholder returns the placeholder of the n-th parameter of a statement, starting at 1.
+	Placeholder(n int) string
+	// ExecPrepared executes the statement with its parameters bound to args.
+	// Statements are prepared once per connection and reused afterwards.
+	ExecPrepared(ctx context.Context, stmt string, args []interface{}) error
 }
 
 // BenchType determines if the particular benchmark should be run several times or only once.
@@ -31,177 +80,995 @@ const (
 )
 
 // Benchmark contains the benchmark name, its db statement and its type.
+// Consecutive parallel benchmarks are executed concurrently, see RunGroup.
 type Benchmark struct {
 	Name      string
 	Type      BenchType
-	IterRatio float64
+	IterRatio float64       // scales the iterations of a loop benchmark, e.g. 0.5 or 2
+	Iter      int           // iterations of a loop benchmark, overrides Options.Iter, still scaled by IterRatio
+	Threads   int           // concurrent workers of a loop benchmark, overrides Options.Threads and Options.Ramp
+	Duration  time.Duration // run a loop benchmark for this long instead of a number of iterations
+	Warmup    Warmup        // executions before the measurement starts, overrides Options.Warmup
 	Parallel  bool
 	Stmt      string
+	Mix       []MixStmt // weighted statements of a mixed workload, executed instead of Stmt
+	Expect    Expect    // result set every execution has to return, otherwise it fails
+	Checksum  bool      // compute the checksum of the returned rows, see Result.Checksum
+	Vars      Vars      // variables of the script, {{.Vars.name}} in the statements
+	Defines   string    // templates defined in the script, available in the statements, see ParseScriptWith
+}
+
+// Vars are the variables of a script, set with '\set <name> <value>' or the command line.
+// Integers and floats are stored as such, so they can be passed to the template functions,
+// e.g. {{call .RandIntBetween 1 .Vars.rows}}, all other values as strings.
+type Vars map[string]interface{}
+
+// ParseVar returns the value of a variable, an int or float64 if it is a number,
+// otherwise the string itself.
+func ParseVar(s string) interface{} {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// MixStmt is a named statement of a mixed workload. Each iteration executes one
+// of the statements, chosen randomly with a probability proportional to its weight.
+type MixStmt struct {
+	Name   string
+	Weight float64
+	Stmt   string
+}
+
+// Options configures how Run executes a benchmark.
+type Options struct {
+	Iter        int           // iterations of a loop benchmark, scaled by its IterRatio
+	Threads     int           // number of concurrent workers of a loop benchmark
+	StmtTimeout time.Duration // max. duration of a single execution, 0 means no timeout
+	Duration    time.Duration // run loop benchmarks for this long instead of Iter iterations, unless they specify their own duration
+	Warmup      Warmup        // warm-up phase of loop benchmarks which don't specify their own
+	Rate        float64       // start loop executions at this fixed rate (ops/s) instead of back to back, 0 disables it
+	Ramp        LoadProfile   // run loop benchmarks in stages of increasing concurrency instead of with Threads
+	Prepared    bool          // execute loop benchmarks as prepared statements, {{param}} values are bound instead of rendered
+}
+
+// Warmup describes the executions of a benchmark before its measurement starts,
+// either a number of iterations or a duration. The zero value disables the warm-up.
+type Warmup struct {
+	Iter     int
+	Duration time.Duration
+}
+
+// ParseWarmup parses either a number of iterations, e.g. "100", or a duration, e.g. "5s".
+func ParseWarmup(s string) (Warmup, error) {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return Warmup{Iter: n}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return Warmup{Duration: d}, nil
+	}
+	return Warmup{}, fmt.Errorf("invalid warm-up %q, neither a number of iterations nor a duration", s)
+}
+
+// IsZero reports whether the warm-up is disabled.
+func (w Warmup) IsZero() bool {
+	return w.Iter <= 0 && w.Duration <= 0
+}
+
+// String returns the warm-up in the format accepted by ParseWarmup.
+func (w Warmup) String() string {
+	if w.Duration > 0 {
+		return w.Duration.String()
+	}
+	return strconv.Itoa(w.Iter)
+}
+
+// Expect describes the result set every execution of a benchmark has to return.
+// An execution returning a different one counts as failed. The zero value expects nothing.
+type Expect struct {
+	Rows     *uint64 // number of rows, nil doesn't check it
+	Checksum string  // checksum of the rows, see Result.Checksum, empty doesn't check it
+}
+
+// Set parses a single expectation, either "rows=<n>" or "checksum=<hash>".
+func (e *Expect) Set(s string) error {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) == 2 && kv[1] != "" {
+		switch kv[0] {
+		case "rows":
+			n, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number of rows %q", kv[1])
+			}
+			e.Rows = &n
+			return nil
+		case "checksum":
+			e.Checksum = strings.ToLower(kv[1])
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid expectation %q, neither rows=<n> nor checksum=<hash>", s)
+}
+
+// IsZero reports whether nothing is expected.
+func (e Expect) IsZero() bool {
+	return e.Rows == nil && e.Checksum == ""
 }
 
-// Result encapsulates the metrics of a benchmark run
+// check returns an error if the rows returned by an execution don't meet the expectation.
+func (e Expect) check(rows rowCounter) error {
+	if e.Rows != nil && rows.rows != *e.Rows {
+		return fmt.Errorf("expected %v rows, got %v", *e.Rows, rows.rows)
+	}
+	if e.Checksum != "" && rows.checksum() != e.Checksum {
+		return fmt.Errorf("expected checksum %v, got %v", e.Checksum, rows.checksum())
+	}
+	return nil
+}
+
+// ErrorSample groups the failed executions of a benchmark sharing the same error message.
+type ErrorSample struct {
+	Message string `json:"message"`
+	Stmt    string `json:"stmt"` // first statement that failed with this message
+	Count   uint64 `json:"count"`
+}
+
+// MaxErrorGroups limits the number of distinct error messages per result. Messages often
+// contain values, e.g. the duplicate key, so a failing benchmark could otherwise record
+// one group per execution. Further messages are counted in the OtherErrors group.
+const MaxErrorGroups = 20
+
+// OtherErrors is the message of the group of errors beyond MaxErrorGroups.
+const OtherErrors = "other errors"
+
+// addError adds count failed executions with the given message to the groups, creating
+// them if necessary.
+func addError(groups map[string]*ErrorSample, msg, stmt string, count uint64) {
+	n := len(groups)
+	if _, ok := groups[OtherErrors]; ok {
+		n--
+	}
+	if _, ok := groups[msg]; !ok && n >= MaxErrorGroups {
+		msg = OtherErrors
+	}
+	if e, ok := groups[msg]; ok {
+		e.Count += count
+	} else {
+		groups[msg] = &ErrorSample{Message: msg, Stmt: stmt, Count: count}
+	}
+}
+
+// Result encapsulates the metrics of a benchmark run.
+// Durations are encoded in nanoseconds in the JSON report, see Report.
 type Result struct {
-	Min                    time.Duration
-	Max                    time.Duration
-	ExecutionTimes         []time.Duration
-	TotalExecutionTime     time.Duration
-	TotalExecutionTimeMult time.Duration
-	Start                  time.Time
-	End                    time.Time
-	Duration               time.Duration
-	TotalExecutionCount    uint64
-}
-
-// Calculates the results arithmetic mean
-func (r Result) ArithMean() time.Duration {
-	if r.TotalExecutionCount == 0 {
-		return 0
+	Iterations          int                     `json:"iterations,omitempty"` // iterations of the benchmark, its \iter or Options.Iter, not scaled by the ratio
+	Min                 time.Duration           `json:"min"`
+	Max                 time.Duration           `json:"max"`
+	Histogram           *Histogram              `json:"histogram"`          // execution times (service times) of the successful executions
+	Response            *Histogram              `json:"response,omitempty"` // response times in rate mode, measured from the scheduled start
+	TotalExecutionTime  time.Duration           `json:"totalExecutionTime"`
+	Start               time.Time               `json:"start"`
+	End                 time.Time               `json:"end"`
+	Duration            time.Duration           `json:"duration"`
+	TotalExecutionCount uint64                  `json:"totalExecutionCount"`
+	ErrorCount          uint64                  `json:"errorCount"`
+	TimeoutCount        uint64                  `json:"timeoutCount"`
+	RowCount            uint64                  `json:"rowCount"`           // rows returned by the successful executions, see RecordRows
+	ByteCount           uint64                  `json:"byteCount"`          // size of the values of these rows as received by the driver
+	Checksum            string                  `json:"checksum,omitempty"` // checksum of the rows of the last successful execution, if Benchmark.Checksum is set
+	Errors              map[string]*ErrorSample `json:"errors,omitempty"`
+	Threads             int                     `json:"threads"`          // number of concurrent goroutines
+	Warmup              *Result                 `json:"warmup,omitempty"` // metrics of the warm-up phase, if there was one
+	Stages              []Result                `json:"stages,omitempty"` // metrics of each stage if the benchmark ran with a load profile
+	Mix                 []Result                `json:"mix,omitempty"`    // metrics of each statement of a mixed workload, in the order of Benchmark.Mix
+}
+
+// add merges the executions of o into r, e.g. to aggregate the stages of a
+// load profile. The durations are summed up, the start and end span both.
+func (r *Result) add(o Result) {
+	if r.Start.IsZero() || (!o.Start.IsZero() && o.Start.Before(r.Start)) {
+		r.Start = o.Start
+	}
+	if o.End.After(r.End) {
+		r.End = o.End
 	}
-	if r.TotalExecutionCount == 1 {
-		return r.TotalExecutionTime
+	r.Duration += o.Duration
+	r.TotalExecutionCount += o.TotalExecutionCount
+	r.ErrorCount += o.ErrorCount
+	r.TimeoutCount += o.TimeoutCount
+	r.RowCount += o.RowCount
+	r.ByteCount += o.ByteCount
+	if o.Checksum != "" {
+		r.Checksum = o.Checksum
+	}
+	if o.Threads > r.Threads {
+		r.Threads = o.Threads
+	}
+
+	for _, e := range o.ErrorSamples() {
+		if r.Errors == nil {
+			r.Errors = map[string]*ErrorSample{}
+		}
+		addError(r.Errors, e.Message, e.Stmt, e.Count)
+	}
+
+	if r.Histogram == nil {
+		r.Histogram = &Histogram{}
+	}
+	r.Histogram.Merge(o.Histogram)
+	if o.Response != nil {
+		if r.Response == nil {
+			r.Response = &Histogram{}
+		}
+		r.Response.Merge(o.Response)
+	}
+	r.Min = r.Histogram.Min()
+	r.Max = r.Histogram.Max()
+	r.TotalExecutionTime = r.Histogram.Sum()
+
+	if len(o.Mix) > 0 && r.Mix == nil {
+		r.Mix = make([]Result, len(o.Mix))
+	}
+	for i := range o.Mix {
+		r.Mix[i].add(o.Mix[i])
 	}
-	return time.Duration(int64(r.TotalExecutionTime) / int64(r.TotalExecutionCount))
 }
 
-// Calculates the results geometric mean
-func (r Result) GeoMean() time.Duration {
-	if r.TotalExecutionCount == 0 {
+// FailedCount returns the number of executions which failed or timed out.
+func (r Result) FailedCount() uint64 {
+	return r.ErrorCount + r.TimeoutCount
+}
+
+// SuccessCount returns the number of executions which neither failed nor timed out.
+func (r Result) SuccessCount() uint64 {
+	return r.TotalExecutionCount - r.FailedCount()
+}
+
+// OpsPerSecond returns the number of executions per second, failed ones included.
+func (r Result) OpsPerSecond() float64 {
+	return perSecond(r.TotalExecutionCount, r.Duration)
+}
+
+// SuccessOpsPerSecond returns the number of successful executions per second.
+func (r Result) SuccessOpsPerSecond() float64 {
+	return perSecond(r.SuccessCount(), r.Duration)
+}
+
+// ErrorOpsPerSecond returns the number of failed executions per second, timeouts included.
+func (r Result) ErrorOpsPerSecond() float64 {
+	return perSecond(r.FailedCount(), r.Duration)
+}
+
+// ErrorSamples returns the grouped errors, most frequent first.
+func (r Result) ErrorSamples() []ErrorSample {
+	samples := make([]ErrorSample, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		samples = append(samples, *e)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Count != samples[j].Count {
+			return samples[i].Count > samples[j].Count
+		}
+		return samples[i].Message < samples[j].Message
+	})
+	return samples
+}
+
+func perSecond(count uint64, d time.Duration) float64 {
+	if d <= 0 {
 		return 0
 	}
-	if r.TotalExecutionCount == 1 {
-		return r.TotalExecutionTime
+	return float64(count) / d.Seconds()
+}
+
+// Calculates the results arithmetic mean, failed executions excluded
+func (r Result) ArithMean() time.Duration {
+	return r.Histogram.Mean()
+}
+
+// Calculates the results geometric mean, failed executions excluded
+func (r Result) GeoMean() time.Duration {
+	return r.Histogram.GeoMean()
+}
+
+// ResponseHistogram returns the response times of the successful executions.
+// They equal the execution times unless the benchmark ran at a fixed rate, where
+// they also include the time an execution was delayed behind its schedule.
+func (r Result) ResponseHistogram() *Histogram {
+	if r.Response != nil {
+		return r.Response
 	}
-	count := float64(0)
-	product := float64(1.0)
-	for _, v := range r.ExecutionTimes {
-		p := float64(v)
-		k := math.Log2(p)
-		count += 1
-		product += k
+	return r.Histogram
+}
+
+// Percentiles lists the latency percentiles reported for every benchmark.
+var Percentiles = []float64{50, 90, 95, 99, 99.9}
+
+// Percentile returns the execution time at or below which p percent of the
+// successful executions finished, using the nearest-rank method.
+func (r Result) Percentile(p float64) time.Duration {
+	return r.Histogram.ValueAt(p)
+}
+
+// PercentileValues returns the execution times for each of the given percentiles.
+func (r Result) PercentileValues(ps ...float64) []time.Duration {
+	values := make([]time.Duration, len(ps))
+	for i, p := range ps {
+		values[i] = r.Percentile(p)
 	}
-	meanExp := product / count
-	return time.Duration(math.Pow(float64(2), meanExp))
+	return values
 }
 
 // bencherExecutor is responsible for running the benchmark, keeping track
 // of metrics as the execution goes
 type bencherExecutor struct {
-	result Result
-	mux    sync.Mutex
+	result      Result
+	mux         sync.Mutex
+	stmtTimeout time.Duration
+	rate        float64
+	iterOffset  int64           // iterations executed by previous runs, {{.Iter}} continues after them
+	mix         *statementMix   // picks the statement of each iteration of a mixed workload
+	prepared    PreparedBencher // executes the statements prepared, nil executes them as rendered
+	expect      Expect          // result set every execution has to return
+	checksum    bool            // whether the checksum of the returned rows is computed
+	vars        Vars            // variables of the statement templates
+	cancel      context.CancelFunc
+	err         error // first error building a statement, it stops the run
+}
+
+// statementMix chooses the statements of a mixed workload by their weights.
+type statementMix struct {
+	templates  []*template.Template
+	cumulative []float64 // cumulative weights, the last one is the total
+}
+
+// newStatementMix parses the templates of a mixed workload, nil is returned if b isn't one.
+func newStatementMix(b Benchmark) (*statementMix, error) {
+	if len(b.Mix) == 0 {
+		return nil, nil
+	}
+	m := &statementMix{}
+	var total float64
+	for _, s := range b.Mix {
+		if s.Weight <= 0 {
+			return nil, fmt.Errorf("weight of statement %v must be > 0: %v", s.Name, s.Weight)
+		}
+		t, err := newTemplate(b.Name+"/"+s.Name, b.Defines, s.Stmt)
+		if err != nil {
+			return nil, err
+		}
+		total += s.Weight
+		m.templates = append(m.templates, t)
+		m.cumulative = append(m.cumulative, total)
+	}
+	return m, nil
+}
+
+// pick returns the index of the statement selected by r, a random number in [0, 1).
+func (m *statementMix) pick(r float64) int {
+	x := r * m.cumulative[len(m.cumulative)-1]
+	i := sort.Search(len(m.cumulative), func(i int) bool { return m.cumulative[i] > x })
+	if i == len(m.cumulative) {
+		i-- // only possible due to rounding
+	}
+	return i
+}
+
+// workerStats accumulates the metrics of a single goroutine without any locking.
+// They are merged into the result once the goroutine is done, so recording an
+// execution neither blocks other goroutines nor allocates.
+type workerStats struct {
+	executions uint64
+	errors     uint64
+	timeouts   uint64
+	rows       uint64
+	bytes      uint64
+	checksum   string     // checksum of the rows of the last successful execution
+	current    rowCounter // rows of the running execution, see RecordRows
+	samples    map[string]*ErrorSample
+	hist       Histogram
+	response   Histogram
+	mix        []workerStats // stats of each statement of a mixed workload
 }
 
-// Run executes the benchmark.
-func Run(bencher Bencher, b Benchmark, iter, threads int) Result {
-	t := template.New(b.Name)
-	t, err := t.Parse(b.Stmt)
+// Run executes the benchmark. It stops early when ctx is cancelled,
+// the executions in flight at that moment are not recorded.
+// If a warm-up is configured, the benchmark is executed accordingly beforehand,
+// its metrics are reported separately in Result.Warmup.
+// An error is returned if the statements can't be built, e.g. a template referring
+// to an undefined variable, unlike the errors of the executions, see Result.Errors.
+func Run(ctx context.Context, bencher Bencher, b Benchmark, opts Options) (Result, error) {
+	t, err := newTemplate(b.Name, b.Defines, b.Stmt)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to parse template: %v", err)
+	}
+	mix, err := newStatementMix(b)
 	if err != nil {
-		log.Fatalf("failed to parse template: %v", err)
+		return Result{}, fmt.Errorf("failed to parse mixed workload: %v", err)
+	}
+	// {{param}} renders the literals of the query language of the bencher
+	funcs := literalFuncs(bencher)
+	t.Funcs(funcs)
+	if mix != nil {
+		for _, m := range mix.templates {
+			m.Funcs(funcs)
+		}
+	}
+	var prepared PreparedBencher
+	if opts.Prepared {
+		p, ok := bencher.(PreparedBencher)
+		if !ok {
+			return Result{}, fmt.Errorf("%T does not support prepared statements", bencher)
+		}
+		// a single execution gains nothing from preparing it
+		if b.Type == TypeLoop {
+			prepared = p
+		}
 	}
 
-	executor := bencherExecutor{
-		result: Result{
-			Start: time.Now(),
-		},
+	warmup := b.Warmup
+	if warmup.IsZero() && b.Type == TypeLoop {
+		warmup = opts.Warmup
+	}
+	threads := opts.Threads
+	if b.Threads > 0 {
+		threads = b.Threads
+	}
+	iter := opts.Iter
+	if b.Iter > 0 {
+		iter = b.Iter
+	}
+	_iter := int(math.Max((float64(iter) * b.IterRatio), 1.0))
+	duration := b.Duration
+	if duration == 0 {
+		duration = opts.Duration
+	}
+	// can't have more threads than iterations
+	if threads > iter && duration == 0 {
+		threads = iter
+	}
+	// a benchmark with its own threads keeps them instead of ramping up
+	ramp := b.Type == TypeLoop && !opts.Ramp.IsZero() && b.Threads == 0
+	if ramp && opts.Ramp.Hold > 0 {
+		duration = opts.Ramp.Hold
 	}
 
+	// the warm-up must not reuse the {{.Iter}} values of the measurement, e.g. the keys
+	// of inserts, so it continues after the measured iterations or, if the measurement
+	// is time-bounded and thus has no end, the measurement continues after the warm-up
+	var warmupResult *Result
+	var offset int64
+	if !warmup.IsZero() {
+		warmupThreads := threads
+		measured := int64(_iter)
+		switch {
+		case b.Type == TypeOnce:
+			warmupThreads = 1
+			measured = 1
+		case ramp:
+			measured *= int64(len(opts.Ramp.Stages()))
+		}
+		executor := newExecutor(opts, b, mix, prepared)
+		timeBounded := b.Type == TypeLoop && duration > 0
+		if !timeBounded {
+			executor.iterOffset = measured
+		}
+		r, err := executor.run(ctx, bencher, b, t, warmup.Iter, warmupThreads, warmup.Duration)
+		if err != nil {
+			return Result{}, err
+		}
+		warmupResult = &r
+		if timeBounded {
+			offset = int64(r.TotalExecutionCount)
+		}
+	}
+
+	var result Result
 	switch b.Type {
 	case TypeOnce:
-		if b.Parallel {
-			go executor.once(bencher, t)
-		} else {
-			executor.once(bencher, t)
+		if result, err = newExecutor(opts, b, mix, prepared).run(ctx, bencher, b, t, 1, 1, 0); err != nil {
+			return Result{}, err
 		}
 	case TypeLoop:
-		_iter := int(math.Max((float64(iter) * b.IterRatio), 1.0))
-		if b.Parallel {
-			go executor.loop(bencher, t, _iter, threads)
-		} else {
-			executor.loop(bencher, t, _iter, threads)
+		if !ramp {
+			executor := newExecutor(opts, b, mix, prepared)
+			executor.rate = opts.Rate
+			executor.iterOffset = offset
+			if result, err = executor.run(ctx, bencher, b, t, _iter, threads, duration); err != nil {
+				return Result{}, err
+			}
+			break
+		}
+
+		// run each stage of the load profile, continuing the iterations of the previous one
+		for _, threads := range opts.Ramp.Stages() {
+			if ctx.Err() != nil {
+				break
+			}
+			executor := newExecutor(opts, b, mix, prepared)
+			executor.rate = opts.Rate
+			executor.iterOffset = offset
+			stage, err := executor.run(ctx, bencher, b, t, _iter, threads, duration)
+			if err != nil {
+				return Result{}, err
+			}
+			stage.Iterations = iter
+			offset += int64(stage.TotalExecutionCount)
+			result.add(stage)
+			result.Stages = append(result.Stages, stage)
+		}
+	}
+	result.Iterations = iter
+	result.Warmup = warmupResult
+
+	return result, nil
+}
+
+// Group splits the benchmarks into the groups to run one after another.
+// Consecutive parallel benchmarks form a single group, any other benchmark
+// is a group of its own.
+func Group(benchmarks []Benchmark) [][]Benchmark {
+	groups := [][]Benchmark{}
+	for i, b := range benchmarks {
+		if b.Parallel && i > 0 && benchmarks[i-1].Parallel {
+			groups[len(groups)-1] = append(groups[len(groups)-1], b)
+			continue
+		}
+		groups = append(groups, []Benchmark{b})
+	}
+	return groups
+}
+
+// RunGroup executes the benchmarks of a group concurrently against the database,
+// e.g. to measure the interference of reads and writes. It waits for all of them
+// to finish and returns their results in the order of the group, or the first
+// error of any of them, see Run.
+func RunGroup(ctx context.Context, bencher Bencher, group []Benchmark, opts Options) ([]Result, error) {
+	results := make([]Result, len(group))
+	errs := make([]error, len(group))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(group))
+	for i, b := range group {
+		go func(i int, b Benchmark) {
+			defer wg.Done()
+			results[i], errs[i] = Run(ctx, bencher, b, opts)
+		}(i, b)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func newExecutor(opts Options, b Benchmark, mix *statementMix, prepared PreparedBencher) *bencherExecutor {
+	return &bencherExecutor{
+		result: Result{
+			Histogram: &Histogram{},
+			Response:  &Histogram{},
+		},
+		stmtTimeout: opts.StmtTimeout,
+		mix:         mix,
+		prepared:    prepared,
+		expect:      b.Expect,
+		checksum:    b.Checksum || b.Expect.Checksum != "",
+		vars:        b.Vars,
+	}
+}
+
+// run executes a single phase of the benchmark, either the given number of
+// iterations or, if duration is set, as many as possible within that time.
+// It stops at the first statement which can't be built and returns the error.
+func (b *bencherExecutor) run(ctx context.Context, bencher Bencher, bench Benchmark, t *template.Template, iterations, threads int, duration time.Duration) (Result, error) {
+	ctx, b.cancel = context.WithCancel(ctx)
+	defer b.cancel()
+	b.result.Start = time.Now()
+	b.result.Threads = threads
+
+	var deadline time.Time
+	if duration > 0 {
+		iterations = 0
+		deadline = b.result.Start.Add(duration)
+	}
+
+	if bench.Type == TypeOnce && iterations == 1 {
+		b.once(ctx, bencher, t)
+	} else {
+		b.loop(ctx, bencher, t, iterations, threads, deadline)
+	}
+
+	b.result.End = time.Now()
+	b.result.Duration = time.Since(b.result.Start)
+	if b.rate <= 0 {
+		b.result.Response = nil
+	}
+	for i := range b.result.Mix {
+		// the statements of a mix share the run, their throughput is relative to it
+		m := &b.result.Mix[i]
+		m.Start, m.End, m.Duration, m.Threads = b.result.Start, b.result.End, b.result.Duration, b.result.Threads
+		if b.rate <= 0 {
+			m.Response = nil
 		}
 	}
 
-	executor.result.End = time.Now()
-	executor.result.Duration = time.Since(executor.result.Start)
+	return b.result, b.err
+}
 
-	return executor.result
+// fail records the error of a statement which can't be built and stops the run.
+func (b *bencherExecutor) fail(err error) {
+	b.mux.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.mux.Unlock()
+	b.cancel()
 }
 
-// loop runs the benchmark concurrently several times.
-func (b *bencherExecutor) loop(bencher Bencher, t *template.Template, iterations, threads int) {
+// loop runs the benchmark concurrently several times, either until the given
+// number of iterations is reached or, if iterations is 0, until the deadline.
+// The goroutines share the iteration counter, so each iteration is executed
+// exactly once and {{.Iter}} increases monotonically across all of them.
+//
+// If a rate is set, the loop is open: iteration i is scheduled to start at
+// (i-1)/rate seconds after the start, independent of how long the previous
+// executions took. Executions which can't start on time because all goroutines
+// are busy are delayed, and the delay is part of their response time. This
+// avoids the coordinated omission of a closed loop, which hides queueing.
+func (b *bencherExecutor) loop(ctx context.Context, bencher Bencher, t *template.Template, iterations, threads int, deadline time.Time) {
 	wg := &sync.WaitGroup{}
 	wg.Add(threads)
 	defer wg.Wait()
 
+	iter := b.iterOffset
+	start := time.Now()
+	var interval time.Duration
+	if b.rate > 0 {
+		interval = time.Duration(float64(time.Second) / b.rate)
+	}
+
 	// start as many routines as specified
 	for routine := 0; routine < threads; routine++ {
-		// calculate the amount of iterations to execute in this routine
-		from := ((iterations / threads) * routine) + 1
-		to := (iterations / threads) * (routine + 1)
-
-		// Add the remainder of iterations to the last routine.
-		if routine == threads-1 {
-			remainder := iterations - to
-			to += remainder
-		}
-
-		// start the routine
-		go func(gofrom, togo int) {
+		go func() {
 			defer wg.Done()
-			// notify channel for SIGINT (ctrl-c)
-			sigchan := make(chan os.Signal, 1)
-			signal.Notify(sigchan, os.Interrupt)
+			stats := b.newStats()
+			defer b.merge(stats)
+			builder := b.newBuilder(t)
 
-			for i := gofrom; i <= togo; i++ {
+			for {
 				select {
-				case <-sigchan:
-					// got SIGINT, stop benchmarking
+				case <-ctx.Done():
+					// benchmark got cancelled, e.g. by SIGINT
 					return
 				default:
-					// build and execute the statement
-					stmt := buildStmt(t, i)
-					now := time.Now()
-					bencher.Exec(stmt)
-					b.collectStats(now)
 				}
+
+				if !deadline.IsZero() && !time.Now().Before(deadline) {
+					return
+				}
+				i := int(atomic.AddInt64(&iter, 1))
+				n := i - int(b.iterOffset) // n-th iteration of this run
+				if iterations > 0 && n > iterations {
+					return
+				}
+
+				var scheduled time.Time
+				if interval > 0 {
+					scheduled = start.Add(time.Duration(n-1) * interval)
+					if !deadline.IsZero() && !scheduled.Before(deadline) {
+						return
+					}
+					if !sleepUntil(ctx, scheduled) {
+						return
+					}
+				}
+
+				// build and execute the statement
+				stmt, args, member, err := b.next(builder, i)
+				if err != nil {
+					b.fail(err)
+					return
+				}
+				b.exec(ctx, bencher, stats, member, stmt, args, scheduled)
 			}
-		}(from, to)
+		}()
+	}
+}
+
+// sleepUntil blocks until the given time, it returns false if ctx got cancelled meanwhile.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err() == nil
 	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// stmtBuilder builds the statements of a single goroutine. When executing prepared
+// statements, {{param}} renders a placeholder and collects the value in args.
+type stmtBuilder struct {
+	t    *template.Template
+	mix  []*template.Template // templates of the statements of a mixed workload
+	args []interface{}
+	rnd  *rand.Rand // random values of the goroutine, rand.Rand isn't safe for concurrent use
 }
 
-func (b *bencherExecutor) collectStats(start time.Time) {
+// newBuilder returns the statement builder of a new goroutine. Prepared statements
+// need a copy of the templates, as {{param}} collects the values of that goroutine.
+func (b *bencherExecutor) newBuilder(t *template.Template) *stmtBuilder {
+	var mix []*template.Template
+	if b.mix != nil {
+		mix = b.mix.templates
+	}
+	rnd := rand.New(rand.NewSource(rand.Int63()))
+	if b.prepared == nil {
+		return &stmtBuilder{t: t, mix: mix, rnd: rnd}
+	}
+
+	s := &stmtBuilder{rnd: rnd}
+	funcs := template.FuncMap{"param": func(v interface{}) string {
+		s.args = append(s.args, v)
+		return b.prepared.Placeholder(len(s.args))
+	}}
+	s.t = template.Must(t.Clone()).Funcs(funcs)
+	for _, m := range mix {
+		s.mix = append(s.mix, template.Must(m.Clone()).Funcs(funcs))
+	}
+	return s
+}
+
+// next builds the statement of iteration i and returns the values of its parameters.
+// In a mixed workload, the statement is picked by weight and its index is returned
+// as well, otherwise the index is -1.
+func (b *bencherExecutor) next(s *stmtBuilder, i int) (string, []interface{}, int, error) {
+	t, member := s.t, -1
+	if b.mix != nil {
+		member = b.mix.pick(s.rnd.Float64())
+		t = s.mix[member]
+	}
+	s.args = nil
+	stmt, err := buildStmt(t, i, b.vars, s.rnd)
+	return stmt, s.args, member, err
+}
+
+// exec executes a single statement within the statement timeout and records its stats,
+// including the stats of the given statement of a mixed workload unless member is -1.
+// A non-zero scheduled time is the time the execution was supposed to start in rate mode.
+func (b *bencherExecutor) exec(ctx context.Context, bencher Bencher, stats *workerStats, member int, stmt string, args []interface{}, scheduled time.Time) {
+	stmtCtx, cancel := ctx, context.CancelFunc(func() {})
+	if b.stmtTimeout > 0 {
+		stmtCtx, cancel = context.WithTimeout(ctx, b.stmtTimeout)
+	}
+	defer cancel()
+
+	stats.current = rowCounter{}
+	if b.checksum {
+		stats.current.hash = sha256.New()
+	}
+	stmtCtx = context.WithValue(stmtCtx, rowsKey{}, &stats.current)
+
+	now := time.Now()
+	var err error
+	if b.prepared != nil {
+		err = b.prepared.ExecPrepared(stmtCtx, stmt, args)
+	} else {
+		err = bencher.Exec(stmtCtx, stmt)
+	}
+	end := time.Now()
+	if err == nil {
+		err = b.expect.check(stats.current)
+	}
+	if ctx.Err() != nil {
+		// the whole benchmark was cancelled, this execution didn't finish regularly
+		return
+	}
+	// a statement succeeding just as the deadline passes isn't timed out
+	timedOut := err != nil && errors.Is(stmtCtx.Err(), context.DeadlineExceeded)
+	stats.collect(now, end, scheduled, stmt, stats.current, err, timedOut)
+	if member >= 0 {
+		stats.mix[member].collect(now, end, scheduled, stmt, stats.current, err, timedOut)
+	}
+}
+
+// newStats returns the stats of a new goroutine.
+func (b *bencherExecutor) newStats() *workerStats {
+	stats := &workerStats{}
+	if b.mix != nil {
+		stats.mix = make([]workerStats, len(b.mix.templates))
+	}
+	return stats
+}
+
+// collect records a single execution and the rows it returned. Failed executions
+// are counted and grouped by their error message, up to MaxErrorGroups, timed out
+// ones are counted separately. Neither contributes to the latency metrics nor to the rows.
+func (s *workerStats) collect(start, end, scheduled time.Time, stmt string, rows rowCounter, err error, timedOut bool) {
+	durTime := end.Sub(start)
+
+	s.executions++
+
+	if timedOut {
+		s.timeouts++
+		return
+	}
+	if err != nil {
+		s.errors++
+		if s.samples == nil {
+			s.samples = map[string]*ErrorSample{}
+		}
+		addError(s.samples, err.Error(), stmt, 1)
+		return
+	}
+
+	s.rows += rows.rows
+	s.bytes += rows.bytes
+	if sum := rows.checksum(); sum != "" {
+		s.checksum = sum
+	}
+	s.hist.Record(durTime)
+	if !scheduled.IsZero() {
+		s.response.Record(end.Sub(scheduled))
+	}
+}
+
+// merge adds the metrics of a finished goroutine to the result.
+func (b *bencherExecutor) merge(s *workerStats) {
 	b.mux.Lock()
 	defer b.mux.Unlock()
 
-	b.result.TotalExecutionCount++
+	b.result.add(s.result())
+}
+
+// result converts the stats to a partial Result.
+func (s *workerStats) result() Result {
+	r := Result{
+		TotalExecutionCount: s.executions,
+		ErrorCount:          s.errors,
+		TimeoutCount:        s.timeouts,
+		RowCount:            s.rows,
+		ByteCount:           s.bytes,
+		Checksum:            s.checksum,
+		Errors:              s.samples,
+		Histogram:           &s.hist,
+		Response:            &s.response,
+	}
+	for i := range s.mix {
+		r.Mix = append(r.Mix, s.mix[i].result())
+	}
+	return r
+}
 
-	durTime := time.Since(start)
+// rowsKey is the context key of the rowCounter of an execution.
+type rowsKey struct{}
 
-	b.result.ExecutionTimes = append(b.result.ExecutionTimes, durTime)
-	b.result.TotalExecutionTime += durTime
-	b.result.TotalExecutionTimeMult *= durTime
+// rowCounter counts the rows returned by a single execution.
+type rowCounter struct {
+	rows  uint64
+	bytes uint64
+	hash  hash.Hash // checksum of the rows, nil unless the benchmark computes it
+}
 
-	if durTime > b.result.Max {
-		b.result.Max = durTime
+// checksum returns the first 8 bytes of the SHA-256 hash of the rows in hex,
+// or an empty string if it isn't computed.
+func (c rowCounter) checksum() string {
+	if c.hash == nil {
+		return ""
 	}
+	return hex.EncodeToString(c.hash.Sum(nil)[:8])
+}
+
+// RecordRows reports rows returned by a statement and the size of their values in bytes.
+// Benchers call it from within Exec with the context passed to Exec, once per statement
+// or once per row. It does nothing if ctx doesn't belong to a benchmark execution.
+func RecordRows(ctx context.Context, rows, bytes int64) {
+	if c, ok := ctx.Value(rowsKey{}).(*rowCounter); ok {
+		c.rows += uint64(rows)
+		c.bytes += uint64(bytes)
+	}
+}
 
-	if durTime < b.result.Min || b.result.Min == 0 {
-		b.result.Min = durTime
+// Checksumming reports whether the benchmark computes the checksum of the rows
+// returned within ctx, so the bencher has to pass them to ChecksumRow.
+func Checksumming(ctx context.Context) bool {
+	c, ok := ctx.Value(rowsKey{}).(*rowCounter)
+	return ok && c.hash != nil
+}
+
+// ChecksumRow adds a returned row to the checksum of the execution. Benchers call it from
+// within Exec for every row in the order received, with the values in their text representation.
+// Databases agree on the checksum only if they represent the values the same way, e.g. the
+// same number of decimal places. NULL is not distinguished from the empty string.
+func ChecksumRow(ctx context.Context, values ...string) {
+	c, ok := ctx.Value(rowsKey{}).(*rowCounter)
+	if !ok || c.hash == nil {
+		return
+	}
+	// length prefixes keep the boundaries of the rows and values unambiguous
+	buf := make([]byte, binary.MaxVarintLen64)
+	c.hash.Write(buf[:binary.PutUvarint(buf, uint64(len(values)))])
+	for _, v := range values {
+		c.hash.Write(buf[:binary.PutUvarint(buf, uint64(len(v)))])
+		io.WriteString(c.hash, v)
 	}
 }
 
 // once runs the benchmark a single time.
-func (b *bencherExecutor) once(bencher Bencher, t *template.Template) {
-	stmt := buildStmt(t, 1)
-	defer b.collectStats(time.Now())
-	bencher.Exec(stmt)
+func (b *bencherExecutor) once(ctx context.Context, bencher Bencher, t *template.Template) {
+	stats := b.newStats()
+	defer b.merge(stats)
+	stmt, args, member, err := b.next(b.newBuilder(t), int(b.iterOffset)+1)
+	if err != nil {
+		b.fail(err)
+		return
+	}
+	b.exec(ctx, bencher, stats, member, stmt, args, time.Time{})
+}
+
+// templateFuncs are the functions available in the statement templates.
+var templateFuncs = template.FuncMap{
+	"param": func(v interface{}) string { return literal(nil, v) },
 }
 
+// literalFuncs returns the template functions rendering the values of {{param}} as
+// literals of the query language of the bencher, see DialectOf.
+func literalFuncs(bencher Bencher) template.FuncMap {
+	d, _ := statement.Lookup(DialectOf(bencher))
+	return template.FuncMap{"param": func(v interface{}) string { return literal(d, v) }}
+}
+
+// newTemplate parses the template of a statement, after the templates it may refer
+// to with {{template}}. Referring to an undefined variable fails, instead of rendering
+// "<no value>" into the statement.
+func newTemplate(name, defines, stmt string) (*template.Template, error) {
+	t := template.New(name).Funcs(templateFuncs).Option("missingkey=error")
+	if defines != "" {
+		if _, err := t.Parse(defines); err != nil {
+			return nil, err
+		}
+	}
+	return t.Parse(stmt)
+}
+
+// literal renders the value of {{param}} into the statement, unless it's prepared.
+// Strings are quoted, their quotes are escaped by doubling them or, if backslashes
+// escape within quotes in the dialect, e.g. in MySQL, by a backslash like the
+// backslashes themselves. The dialect may be nil if it's unknown.
+func literal(d *statement.Dialect, v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		if d != nil && d.BackslashEscapes {
+			return "'" + backslashEscaper.Replace(v) + "'"
+		}
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// backslashEscaper escapes the strings of dialects with backslash escapes.
+var backslashEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
 // buildStmt parses the given template with variables and functions to a pure DB statement.
-func buildStmt(t *template.Template, i int) string {
+// The random values are drawn from rnd.
+func buildStmt(t *template.Template, i int, vars Vars, rnd *rand.Rand) (string, error) {
 	sb := &strings.Builder{}
 
 	data := struct {
 		Iter             int
+		Vars             Vars
 		RandIntBetween   func(int, int) int
 		RandFloatBetween func(float64, float64) float64
 		RandFloat64      func() float64
@@ -210,41 +1077,42 @@ func buildStmt(t *template.Template, i int) string {
 		RandDate         func() string
 	}{
 		Iter:             i,
-		RandIntBetween:   RandInt,
-		RandFloatBetween: RandFloat64Between,
-		RandFloat64:      rand.Float64,
-		RandInt64:        rand.Int63,
-		RandString:       RandStringBytes,
-		RandDate:         RandDate,
+		Vars:             vars,
+		RandIntBetween:   func(min, max int) int { return RandInt(rnd, min, max) },
+		RandFloatBetween: func(min, max float64) float64 { return RandFloat64Between(rnd, min, max) },
+		RandFloat64:      rnd.Float64,
+		RandInt64:        rnd.Int63,
+		RandString:       func(min, max int) string { return RandStringBytes(rnd, min, max) },
+		RandDate:         func() string { return RandDate(rnd) },
 	}
 	if err := t.Execute(sb, data); err != nil {
-		log.Fatalf("failed to execute template: %v", err)
+		return "", fmt.Errorf("failed to execute template: %v", err)
 	}
-	return sb.String()
+	return sb.String(), nil
 }
 
-func RandInt(min int, max int) int {
-	return rand.Intn(max-min) + min
+func RandInt(rnd *rand.Rand, min int, max int) int {
+	return rnd.Intn(max-min) + min
 }
 
-func RandFloat64Between(min float64, max float64) float64 {
-	return min + rand.Float64()*(max-min)
+func RandFloat64Between(rnd *rand.Rand, min float64, max float64) float64 {
+	return min + rnd.Float64()*(max-min)
 }
 
-func RandStringBytes(min int, max int) string {
+func RandStringBytes(rnd *rand.Rand, min int, max int) string {
 	var letters = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	n := rand.Intn(max-min) + min
+	n := rnd.Intn(max-min) + min
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+		b[i] = letters[rnd.Intn(len(letters))]
 	}
 	return string(b)
 }
 
-func RandDate() string {
+func RandDate(rnd *rand.Rand) string {
 	min := time.Date(1970, 1, 0, 0, 0, 0, 0, time.UTC).Unix()
 	max := time.Date(2023, 1, 0, 0, 0, 0, 0, time.UTC).Unix()
 	delta := max - min
-	sec := rand.Int63n(delta) + min
+	sec := rnd.Int63n(delta) + min
 	return time.Unix(sec, 0).Format("2006-01-02")
 }
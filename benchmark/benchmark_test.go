@@ -1,11 +1,18 @@
 package benchmark
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
 	"testing"
 	"text/template"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -15,19 +22,23 @@ type mockedBencher struct {
 }
 
 func (b *mockedBencher) Benchmarks() []Benchmark { return []Benchmark{} }
-func (b *mockedBencher) Setup()                  {}
+func (b *mockedBencher) Setup() error            { return nil }
 func (b *mockedBencher) Cleanup(closeConn bool)  {}
-func (b *mockedBencher) Exec(s string)           { _ = b.Called(s) }
+func (b *mockedBencher) Close()                  {}
+func (b *mockedBencher) Exec(ctx context.Context, s string) error {
+	return b.Called(ctx, s).Error(0)
+}
 
 func TestBuildStmt(t *testing.T) {
 	// arrange
-	tmpl := template.Must(template.New("test").Parse("{{.Iter}} {{call .RandInt64}}"))
+	tmpl := template.Must(template.New("test").Parse("{{.Iter}} {{call .RandInt64}} {{.Vars.table}}"))
 
 	// act
-	stmt := buildStmt(tmpl, 1337)
+	stmt, err := buildStmt(tmpl, 1337, Vars{"table": "t1"}, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
 
 	// assert
-	want := "1337 5577006791947779410"
+	want := "1337 5577006791947779410 t1"
 	if stmt != want {
 		t.Errorf("got statement %v, want %v", stmt, want)
 	}
@@ -52,14 +63,15 @@ func TestRun(t *testing.T) {
 		t.Run(tt.description, func(t *testing.T) {
 			// arrange
 			bencher := &mockedBencher{}
-			bencher.On("Exec", mock.Anything)
+			bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
 
 			iter := 13
 			threads := 5
 			bLoop := Benchmark{Name: "test", Type: tt.givenType, IterRatio: 1.0, Stmt: "NONE"}
 
 			// act
-			Run(bencher, bLoop, iter, threads)
+			_, err := Run(context.Background(), bencher, bLoop, Options{Iter: iter, Threads: threads})
+			require.NoError(t, err)
 
 			// assert
 			switch tt.givenType {
@@ -75,7 +87,7 @@ func TestRun(t *testing.T) {
 func TestLoop(t *testing.T) {
 	// arrange
 	bencher := &mockedBencher{}
-	bencher.On("Exec", mock.Anything)
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
 	tmpl := template.Must(template.New("test").Parse("{{.Iter}} {{call .RandInt64}}"))
 
 	executor := bencherExecutor{
@@ -85,7 +97,7 @@ func TestLoop(t *testing.T) {
 	}
 
 	// act
-	executor.loop(bencher, tmpl, 17, 5)
+	executor.loop(context.Background(), bencher, tmpl, 17, 5, time.Time{})
 
 	// assert
 	bencher.AssertNumberOfCalls(t, "Exec", 17)
@@ -94,7 +106,7 @@ func TestLoop(t *testing.T) {
 func TestOnce(t *testing.T) {
 	// arrange
 	bencher := &mockedBencher{}
-	bencher.On("Exec", mock.Anything)
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
 	tmpl := template.Must(template.New("test").Parse("{{.Iter}} {{call .RandInt64}}"))
 
 	executor := bencherExecutor{
@@ -104,7 +116,7 @@ func TestOnce(t *testing.T) {
 	}
 
 	// act
-	executor.once(bencher, tmpl)
+	executor.once(context.Background(), bencher, tmpl)
 
 	// assert
 	bencher.AssertNumberOfCalls(t, "Exec", 1)
@@ -113,7 +125,7 @@ func TestOnce(t *testing.T) {
 func TestResults(t *testing.T) {
 	// arrange
 	bencher := &mockedBencher{}
-	bencher.On("Exec", mock.Anything)
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
 	tmpl := template.Must(template.New("test").Parse("{{.Iter}} {{call .RandInt64}}"))
 
 	executor := bencherExecutor{
@@ -123,9 +135,693 @@ func TestResults(t *testing.T) {
 	}
 
 	// act
-	executor.once(bencher, tmpl)
+	executor.once(context.Background(), bencher, tmpl)
 
 	assert.Equal(t, uint64(1), executor.result.TotalExecutionCount)
 
 	assert.Equal(t, executor.result.TotalExecutionTime, executor.result.ArithMean())
 }
+
+func TestResultsWithErrors(t *testing.T) {
+	// arrange
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, "1").Return(errors.New("duplicate key"))
+	bencher.On("Exec", mock.Anything, "2").Return(errors.New("duplicate key"))
+	bencher.On("Exec", mock.Anything, "3").Return(errors.New("syntax error"))
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+	tmpl := template.Must(template.New("test").Parse("{{.Iter}}"))
+
+	executor := bencherExecutor{
+		result: Result{
+			Start: time.Now(),
+		},
+	}
+
+	// act
+	executor.loop(context.Background(), bencher, tmpl, 10, 1, time.Time{})
+
+	// assert
+	assert.Equal(t, uint64(10), executor.result.TotalExecutionCount)
+	assert.Equal(t, uint64(3), executor.result.ErrorCount)
+	assert.Equal(t, uint64(7), executor.result.SuccessCount())
+	assert.Equal(t, []ErrorSample{
+		{Message: "duplicate key", Stmt: "1", Count: 2},
+		{Message: "syntax error", Stmt: "3", Count: 1},
+	}, executor.result.ErrorSamples())
+}
+
+func TestResultsWithDistinctErrors(t *testing.T) {
+	// arrange
+	tmpl := template.Must(template.New("test").Parse("{{.Iter}}"))
+
+	executor := bencherExecutor{
+		result: Result{
+			Start: time.Now(),
+		},
+	}
+
+	// act
+	executor.loop(context.Background(), failingBencher{}, tmpl, 100, 4, time.Time{})
+
+	// assert
+	assert.Equal(t, uint64(100), executor.result.ErrorCount)
+	assert.Len(t, executor.result.Errors, MaxErrorGroups+1)
+	var count uint64
+	for _, e := range executor.result.Errors {
+		count += e.Count
+	}
+	assert.Equal(t, uint64(100), count)
+	assert.Equal(t, OtherErrors, executor.result.ErrorSamples()[0].Message)
+}
+
+// failingBencher fails every execution with an error containing the statement.
+type failingBencher struct{}
+
+func (failingBencher) Setup() error                 { return nil }
+func (failingBencher) Cleanup(closeConnection bool) {}
+func (failingBencher) Close()                       {}
+func (failingBencher) Benchmarks() []Benchmark      { return nil }
+func (failingBencher) Exec(ctx context.Context, stmt string) error {
+	return fmt.Errorf("duplicate entry '%v'", stmt)
+}
+
+func TestStmtTimeout(t *testing.T) {
+	// arrange
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, "1").Return(errors.New("canceled")).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	})
+	// succeeds only after the deadline passed, which still isn't a timeout
+	bencher.On("Exec", mock.Anything, "2").Return(nil).Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	})
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+	b := Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "{{.Iter}}"}
+
+	// act
+	result, err := Run(context.Background(), bencher, b, Options{Iter: 4, Threads: 2, StmtTimeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	// assert
+	assert.Equal(t, uint64(4), result.TotalExecutionCount)
+	assert.Equal(t, uint64(1), result.TimeoutCount)
+	assert.Equal(t, uint64(0), result.ErrorCount)
+	assert.Equal(t, uint64(3), result.SuccessCount())
+}
+
+func TestRunCancelled(t *testing.T) {
+	// arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, "3").Return(errors.New("canceled")).Run(func(args mock.Arguments) {
+		cancel()
+	})
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+	b := Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "{{.Iter}}"}
+
+	// act
+	result, err := Run(ctx, bencher, b, Options{Iter: 100, Threads: 1})
+	require.NoError(t, err)
+
+	// assert
+	bencher.AssertNumberOfCalls(t, "Exec", 3)
+	assert.Equal(t, uint64(2), result.TotalExecutionCount)
+	assert.Equal(t, uint64(0), result.ErrorCount)
+}
+
+func TestPercentiles(t *testing.T) {
+	// arrange
+	result := Result{TotalExecutionCount: 1000, Histogram: &Histogram{}}
+	for i := 1000; i >= 1; i-- {
+		result.Histogram.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	// act
+	got := result.PercentileValues(0, 50, 90, 99.9, 100)
+
+	// assert
+	want := []time.Duration{
+		1 * time.Microsecond,
+		500 * time.Microsecond,
+		900 * time.Microsecond,
+		999 * time.Microsecond,
+		1000 * time.Microsecond,
+	}
+	for i := range want {
+		assert.InEpsilon(t, float64(want[i]), float64(got[i]), 0.001)
+	}
+	assert.InEpsilon(t, float64(990*time.Microsecond), float64(result.Percentile(99)), 0.001)
+	assert.Equal(t, time.Duration(0), Result{}.Percentile(50))
+}
+
+func TestRunDuration(t *testing.T) {
+	// arrange
+	var mux sync.Mutex
+	seen := map[string]bool{}
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		mux.Lock()
+		defer mux.Unlock()
+		seen[args.String(1)] = true
+		time.Sleep(time.Millisecond)
+	})
+	b := Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Duration: 50 * time.Millisecond, Stmt: "{{.Iter}}"}
+
+	// act
+	result, err := Run(context.Background(), bencher, b, Options{Iter: 1, Threads: 4})
+	require.NoError(t, err)
+
+	// assert
+	assert.GreaterOrEqual(t, int64(result.Duration), int64(50*time.Millisecond))
+	assert.Greater(t, result.TotalExecutionCount, uint64(4))
+	// every iteration is executed exactly once, without gaps
+	assert.Len(t, seen, int(result.TotalExecutionCount))
+	for i := 1; i <= int(result.TotalExecutionCount); i++ {
+		assert.True(t, seen[fmt.Sprint(i)], "iteration %v", i)
+	}
+}
+
+func TestRunWarmup(t *testing.T) {
+	testCases := []struct {
+		description  string
+		givenBench   Benchmark
+		givenOptions Options
+		wantWarmup   uint64
+		wantMeasured uint64
+	}{
+		{
+			description:  "global warm-up",
+			givenBench:   Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "NONE"},
+			givenOptions: Options{Iter: 10, Threads: 2, Warmup: Warmup{Iter: 5}},
+			wantWarmup:   5,
+			wantMeasured: 10,
+		},
+		{
+			description:  "benchmark warm-up overrides global one",
+			givenBench:   Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Warmup: Warmup{Iter: 3}, Stmt: "NONE"},
+			givenOptions: Options{Iter: 10, Threads: 2, Warmup: Warmup{Iter: 5}},
+			wantWarmup:   3,
+			wantMeasured: 10,
+		},
+		{
+			description:  "global warm-up ignores once",
+			givenBench:   Benchmark{Name: "test", Type: TypeOnce, IterRatio: 1.0, Stmt: "NONE"},
+			givenOptions: Options{Iter: 10, Threads: 2, Warmup: Warmup{Iter: 5}},
+			wantMeasured: 1,
+		},
+		{
+			description:  "once with warm-up",
+			givenBench:   Benchmark{Name: "test", Type: TypeOnce, IterRatio: 1.0, Warmup: Warmup{Iter: 2}, Stmt: "NONE"},
+			givenOptions: Options{Iter: 10, Threads: 2},
+			wantWarmup:   2,
+			wantMeasured: 1,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			// arrange
+			bencher := &mockedBencher{}
+			bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+
+			// act
+			result, err := Run(context.Background(), bencher, tt.givenBench, tt.givenOptions)
+			require.NoError(t, err)
+
+			// assert
+			bencher.AssertNumberOfCalls(t, "Exec", int(tt.wantWarmup+tt.wantMeasured))
+			assert.Equal(t, tt.wantMeasured, result.TotalExecutionCount)
+			if tt.wantWarmup == 0 {
+				assert.Nil(t, result.Warmup)
+			} else {
+				require.NotNil(t, result.Warmup)
+				assert.Equal(t, tt.wantWarmup, result.Warmup.TotalExecutionCount)
+				assert.False(t, result.Start.Before(result.Warmup.End))
+			}
+		})
+	}
+}
+
+func TestRunTemplateError(t *testing.T) {
+	// arrange
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+
+	for _, typ := range []BenchType{TypeLoop, TypeOnce} {
+		// act
+		_, err := Run(context.Background(), bencher, Benchmark{Name: "test", Type: typ, IterRatio: 1.0, Stmt: "{{.Vars.undefined}}", Vars: Vars{}}, Options{Iter: 100, Threads: 4})
+
+		// assert
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `map has no entry for key "undefined"`)
+		}
+	}
+	bencher.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything)
+
+	_, err := Run(context.Background(), bencher, Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "{{.Iter"}, Options{Iter: 1, Threads: 1})
+	assert.Error(t, err)
+	_, err = Run(context.Background(), bencher, Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "{{.Iter}}"}, Options{Iter: 1, Threads: 1, Prepared: true})
+	assert.EqualError(t, err, "*benchmark.mockedBencher does not support prepared statements")
+}
+
+func TestRunWarmupIterations(t *testing.T) {
+	for _, b := range []Benchmark{
+		{Name: "iterations", Type: TypeLoop, IterRatio: 1.0, Stmt: "{{.Iter}}"},
+		{Name: "duration", Type: TypeLoop, IterRatio: 1.0, Duration: 20 * time.Millisecond, Stmt: "{{.Iter}}"},
+		{Name: "once", Type: TypeOnce, IterRatio: 1.0, Warmup: Warmup{Iter: 2}, Stmt: "{{.Iter}}"},
+	} {
+		t.Run(b.Name, func(t *testing.T) {
+			// arrange
+			var mux sync.Mutex
+			seen := map[string]int{}
+			bencher := &mockedBencher{}
+			bencher.On("Exec", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				mux.Lock()
+				defer mux.Unlock()
+				seen[args.String(1)]++
+			})
+
+			// act
+			result, err := Run(context.Background(), bencher, b, Options{Iter: 10, Threads: 2, Warmup: Warmup{Iter: 5}})
+			require.NoError(t, err)
+
+			// assert: the warm-up and the measurement never execute the same iteration
+			require.NotNil(t, result.Warmup)
+			total := int(result.Warmup.TotalExecutionCount + result.TotalExecutionCount)
+			assert.Len(t, seen, total)
+			for i := 1; i <= total; i++ {
+				assert.Equal(t, 1, seen[fmt.Sprint(i)], "iteration %v", i)
+			}
+		})
+	}
+}
+
+func TestParseWarmup(t *testing.T) {
+	w, err := ParseWarmup("100")
+	require.NoError(t, err)
+	assert.Equal(t, Warmup{Iter: 100}, w)
+	assert.Equal(t, "100", w.String())
+
+	w, err = ParseWarmup("1m30s")
+	require.NoError(t, err)
+	assert.Equal(t, Warmup{Duration: 90 * time.Second}, w)
+	assert.Equal(t, "1m30s", w.String())
+
+	w, err = ParseWarmup("0")
+	require.NoError(t, err)
+	assert.True(t, w.IsZero())
+
+	_, err = ParseWarmup("-1")
+	assert.Error(t, err)
+}
+
+func TestRunRate(t *testing.T) {
+	t.Run("paced", func(t *testing.T) {
+		// arrange
+		bencher := &mockedBencher{}
+		bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+		b := Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "NONE"}
+
+		// act
+		result, err := Run(context.Background(), bencher, b, Options{Iter: 11, Threads: 4, Rate: 200})
+		require.NoError(t, err)
+
+		// assert: 10 intervals of 5ms between the first and the last start
+		assert.Equal(t, uint64(11), result.TotalExecutionCount)
+		assert.GreaterOrEqual(t, int64(result.Duration), int64(50*time.Millisecond))
+		require.NotNil(t, result.Response)
+		assert.Equal(t, uint64(11), result.Response.Count())
+	})
+
+	t.Run("coordinated omission", func(t *testing.T) {
+		// arrange
+		bencher := &mockedBencher{}
+		bencher.On("Exec", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			time.Sleep(10 * time.Millisecond)
+		})
+		b := Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "NONE"}
+
+		// act: one thread can only serve 100 ops/s, but 200 ops/s are scheduled
+		result, err := Run(context.Background(), bencher, b, Options{Iter: 10, Threads: 1, Rate: 200})
+		require.NoError(t, err)
+
+		// assert: the 10th execution is scheduled at 45ms but only finishes after 100ms
+		assert.Less(t, int64(result.Max), int64(40*time.Millisecond))
+		assert.Greater(t, int64(result.ResponseHistogram().Max()), int64(50*time.Millisecond))
+		assert.Greater(t, int64(result.ResponseHistogram().Mean()), int64(result.ArithMean()))
+	})
+
+	t.Run("closed loop", func(t *testing.T) {
+		// arrange
+		bencher := &mockedBencher{}
+		bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+		b := Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "NONE"}
+
+		// act
+		result, err := Run(context.Background(), bencher, b, Options{Iter: 10, Threads: 2})
+		require.NoError(t, err)
+
+		// assert
+		assert.Nil(t, result.Response)
+		assert.Equal(t, result.Histogram, result.ResponseHistogram())
+	})
+}
+
+func TestRunRamp(t *testing.T) {
+	// arrange
+	var mux sync.Mutex
+	seen := map[string]bool{}
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		mux.Lock()
+		defer mux.Unlock()
+		seen[args.String(1)] = true
+	})
+	b := Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Stmt: "{{.Iter}}"}
+
+	// act
+	result, err := Run(context.Background(), bencher, b, Options{Iter: 10, Threads: 1, Ramp: LoadProfile{From: 1, To: 4, Step: 2}})
+	require.NoError(t, err)
+
+	// assert
+	require.Len(t, result.Stages, 3)
+	for i, threads := range []int{1, 2, 4} {
+		assert.Equal(t, threads, result.Stages[i].Threads)
+		assert.Equal(t, uint64(10), result.Stages[i].TotalExecutionCount)
+	}
+	assert.Equal(t, uint64(30), result.TotalExecutionCount)
+	assert.Equal(t, uint64(30), result.Histogram.Count())
+	assert.Equal(t, 4, result.Threads)
+	// the stages continue the iterations of the previous ones
+	assert.Len(t, seen, 30)
+	assert.True(t, seen["30"])
+}
+
+func TestRunOverrides(t *testing.T) {
+	// arrange
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+	opts := Options{Iter: 10, Threads: 4}
+
+	testCases := []struct {
+		description string
+		b           Benchmark
+		executions  uint64
+		threads     int
+		iter        int
+	}{
+		{"ratio above 1", Benchmark{IterRatio: 2.5}, 25, 4, 10},
+		{"own iterations", Benchmark{IterRatio: 1.0, Iter: 7}, 7, 4, 7},
+		{"own iterations scaled", Benchmark{IterRatio: 0.5, Iter: 40}, 20, 4, 40},
+		{"own threads", Benchmark{IterRatio: 1.0, Threads: 1}, 10, 1, 10},
+		{"threads capped by own iterations", Benchmark{IterRatio: 1.0, Iter: 2}, 2, 2, 2},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			tt.b.Name, tt.b.Type, tt.b.Stmt = "test", TypeLoop, "{{.Iter}}"
+
+			// act
+			result, err := Run(context.Background(), bencher, tt.b, opts)
+			require.NoError(t, err)
+
+			// assert
+			assert.Equal(t, tt.executions, result.TotalExecutionCount)
+			assert.Equal(t, tt.threads, result.Threads)
+			assert.Equal(t, tt.iter, result.Iterations)
+		})
+	}
+
+	// a benchmark with its own threads isn't ramped up
+	opts.Ramp = LoadProfile{From: 1, To: 4, Step: 2}
+	result, err := Run(context.Background(), bencher, Benchmark{Name: "test", Type: TypeLoop, IterRatio: 1.0, Threads: 2, Stmt: "{{.Iter}}"}, opts)
+	require.NoError(t, err)
+	assert.Empty(t, result.Stages)
+	assert.Equal(t, 2, result.Threads)
+	assert.Equal(t, uint64(10), result.TotalExecutionCount)
+}
+
+func TestGroup(t *testing.T) {
+	// arrange
+	benchmarks := []Benchmark{
+		{Name: "setup"},
+		{Name: "reads", Parallel: true},
+		{Name: "writes", Parallel: true},
+		{Name: "check"},
+		{Name: "reads again", Parallel: true},
+	}
+
+	// act
+	groups := Group(benchmarks)
+
+	// assert
+	assert.Equal(t, [][]Benchmark{
+		{{Name: "setup"}},
+		{{Name: "reads", Parallel: true}, {Name: "writes", Parallel: true}},
+		{{Name: "check"}},
+		{{Name: "reads again", Parallel: true}},
+	}, groups)
+}
+
+func TestRunGroup(t *testing.T) {
+	// arrange: each benchmark blocks until the other one started
+	readStarted, writeStarted := make(chan struct{}), make(chan struct{})
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, "READ").Return(nil).Once().Run(func(args mock.Arguments) {
+		close(readStarted)
+		<-writeStarted
+	})
+	bencher.On("Exec", mock.Anything, "WRITE").Return(nil).Once().Run(func(args mock.Arguments) {
+		close(writeStarted)
+		<-readStarted
+	})
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+	group := []Benchmark{
+		{Name: "reads", Type: TypeLoop, IterRatio: 1.0, Parallel: true, Stmt: "READ"},
+		{Name: "writes", Type: TypeLoop, IterRatio: 0.5, Parallel: true, Stmt: "WRITE"},
+	}
+
+	// act
+	results, err := RunGroup(context.Background(), bencher, group, Options{Iter: 10, Threads: 1})
+	require.NoError(t, err)
+
+	// assert
+	require.Len(t, results, 2)
+	assert.Equal(t, uint64(10), results[0].TotalExecutionCount)
+	assert.Equal(t, uint64(5), results[1].TotalExecutionCount)
+	assert.False(t, results[0].End.IsZero())
+	assert.False(t, results[1].End.IsZero())
+}
+
+func TestRunMix(t *testing.T) {
+	// arrange
+	bencher := &mockedBencher{}
+	bencher.On("Exec", mock.Anything, mock.MatchedBy(func(s string) bool { return s[0] == 'u' })).Return(errors.New("failed"))
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+	b := Benchmark{Name: "oltp", Type: TypeLoop, IterRatio: 1.0, Mix: []MixStmt{
+		{Name: "select", Weight: 7, Stmt: "select {{.Iter}}"},
+		{Name: "update", Weight: 2, Stmt: "update {{.Iter}}"},
+		{Name: "insert", Weight: 1, Stmt: "insert {{.Iter}}"},
+	}}
+
+	// act
+	result, err := Run(context.Background(), bencher, b, Options{Iter: 2000, Threads: 4})
+	require.NoError(t, err)
+
+	// assert
+	assert.Equal(t, uint64(2000), result.TotalExecutionCount)
+	require.Len(t, result.Mix, 3)
+	var executions uint64
+	for _, m := range result.Mix {
+		executions += m.TotalExecutionCount
+		assert.Equal(t, result.Duration, m.Duration)
+		assert.Equal(t, 4, m.Threads)
+	}
+	assert.Equal(t, result.TotalExecutionCount, executions)
+	assert.InDelta(t, 1400, result.Mix[0].TotalExecutionCount, 150)
+	assert.InDelta(t, 400, result.Mix[1].TotalExecutionCount, 150)
+	assert.InDelta(t, 200, result.Mix[2].TotalExecutionCount, 150)
+	// failures are attributed to the statement which caused them
+	assert.Equal(t, result.Mix[1].TotalExecutionCount, result.ErrorCount)
+	assert.Equal(t, result.Mix[1].TotalExecutionCount, result.Mix[1].ErrorCount)
+	assert.Equal(t, uint64(0), result.Mix[1].Histogram.Count())
+	assert.Equal(t, result.Histogram.Count(), result.Mix[0].Histogram.Count()+result.Mix[2].Histogram.Count())
+}
+
+func TestStatementMixPick(t *testing.T) {
+	mix, err := newStatementMix(Benchmark{Mix: []MixStmt{
+		{Name: "a", Weight: 1, Stmt: "a"},
+		{Name: "b", Weight: 3, Stmt: "b"},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, mix.pick(0))
+	assert.Equal(t, 0, mix.pick(0.2499))
+	assert.Equal(t, 1, mix.pick(0.25))
+	assert.Equal(t, 1, mix.pick(0.9999))
+
+	_, err = newStatementMix(Benchmark{Mix: []MixStmt{{Name: "a", Weight: 0, Stmt: "a"}}})
+	assert.Error(t, err)
+}
+
+// preparedBencher records the prepared executions, its placeholders are $1, $2 and so on.
+type preparedBencher struct {
+	mockedBencher
+	mux   sync.Mutex
+	execs map[string][][]interface{}
+}
+
+func (b *preparedBencher) Placeholder(n int) string { return fmt.Sprintf("$%v", n) }
+func (b *preparedBencher) ExecPrepared(ctx context.Context, stmt string, args []interface{}) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.execs == nil {
+		b.execs = map[string][][]interface{}{}
+	}
+	b.execs[stmt] = append(b.execs[stmt], args)
+	return nil
+}
+
+func TestRunPrepared(t *testing.T) {
+	// arrange
+	bencher := &preparedBencher{}
+	bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+	loop := Benchmark{Name: "loop", Type: TypeLoop, IterRatio: 1.0, Stmt: "insert {{param .Iter}}, {{param (printf \"n%v\" .Iter)}}"}
+	once := Benchmark{Name: "once", Type: TypeOnce, Stmt: "insert {{param .Iter}}, {{param \"it's\"}}"}
+
+	// act
+	result, err := Run(context.Background(), bencher, loop, Options{Iter: 20, Threads: 4, Prepared: true})
+	require.NoError(t, err)
+	_, err = Run(context.Background(), bencher, once, Options{Iter: 20, Threads: 4, Prepared: true})
+	require.NoError(t, err)
+
+	// assert
+	assert.Equal(t, uint64(20), result.SuccessCount())
+	require.Len(t, bencher.execs, 1)
+	args := bencher.execs["insert $1, $2"]
+	require.Len(t, args, 20)
+	for _, a := range args {
+		require.Len(t, a, 2)
+		assert.Equal(t, fmt.Sprintf("n%v", a[0]), a[1])
+	}
+	// a single execution isn't prepared, the values are rendered as literals
+	bencher.AssertCalled(t, "Exec", mock.Anything, "insert 1, 'it''s'")
+}
+
+// dialectBencher is a bencher of a query language, see DialectBencher.
+type dialectBencher struct {
+	mockedBencher
+	dialect string
+}
+
+func (b *dialectBencher) Dialect() string { return b.dialect }
+
+func TestRunLiteral(t *testing.T) {
+	testCases := []struct {
+		dialect string
+		stmt    string
+	}{
+		{"", `insert 'it''s \n', NULL, 1.5`},
+		{"postgres", `insert 'it''s \n', NULL, 1.5`},
+		{"mssql", `insert 'it''s \n', NULL, 1.5`},
+		{"mysql", `insert 'it\'s \\n', NULL, 1.5`},
+		{"cypher", `insert 'it\'s \\n', NULL, 1.5`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(fmt.Sprintf("dialect %q", tt.dialect), func(t *testing.T) {
+			// arrange
+			bencher := &dialectBencher{dialect: tt.dialect}
+			bencher.On("Exec", mock.Anything, mock.Anything).Return(nil)
+			b := Benchmark{Name: "once", Type: TypeOnce, Stmt: `insert {{param "it's \\n"}}, {{param .Vars.none}}, {{param 1.5}}`, Vars: Vars{"none": nil}}
+
+			// act
+			_, err := Run(context.Background(), bencher, b, Options{Iter: 1, Threads: 1})
+			require.NoError(t, err)
+
+			// assert
+			bencher.AssertCalled(t, "Exec", mock.Anything, tt.stmt)
+		})
+	}
+}
+
+// rowsBencher returns as many rows as the statement says, each of them 10 bytes
+// with the row number as value.
+type rowsBencher struct {
+	mockedBencher
+}
+
+func (b *rowsBencher) Exec(ctx context.Context, s string) error {
+	rows, _ := strconv.Atoi(s)
+	if rows < 0 {
+		RecordRows(ctx, 1, 10)
+		return errors.New("failed")
+	}
+	for i := 0; i < rows; i++ {
+		RecordRows(ctx, 1, 10)
+		if Checksumming(ctx) {
+			ChecksumRow(ctx, strconv.Itoa(i))
+		}
+	}
+	return nil
+}
+
+func TestRunRows(t *testing.T) {
+	// arrange
+	bencher := &rowsBencher{}
+	b := Benchmark{Name: "rows", Type: TypeLoop, IterRatio: 1.0, Mix: []MixStmt{
+		{Name: "one", Weight: 1, Stmt: "1"},
+		{Name: "three", Weight: 1, Stmt: "3"},
+		{Name: "failed", Weight: 1, Stmt: "-1"},
+	}}
+
+	// act
+	result, err := Run(context.Background(), bencher, b, Options{Iter: 300, Threads: 4})
+	require.NoError(t, err)
+
+	// assert
+	require.Len(t, result.Mix, 3)
+	assert.Equal(t, result.Mix[0].TotalExecutionCount, result.Mix[0].RowCount)
+	assert.Equal(t, 3*result.Mix[1].TotalExecutionCount, result.Mix[1].RowCount)
+	// rows of failed executions are not counted
+	assert.Equal(t, uint64(0), result.Mix[2].RowCount)
+	assert.Equal(t, result.Mix[0].RowCount+result.Mix[1].RowCount, result.RowCount)
+	assert.Equal(t, 10*result.RowCount, result.ByteCount)
+}
+
+func TestRunExpect(t *testing.T) {
+	bencher := &rowsBencher{}
+	three := uint64(3)
+
+	// no checksum unless requested
+	result, err := Run(context.Background(), bencher, Benchmark{Name: "plain", Type: TypeOnce, Stmt: "3"}, Options{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Checksum)
+
+	result, err = Run(context.Background(), bencher, Benchmark{Name: "rows", Type: TypeOnce, Stmt: "3", Checksum: true, Expect: Expect{Rows: &three}}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), result.FailedCount(), "%v", result.ErrorSamples())
+	assert.Len(t, result.Checksum, 16)
+	checksum := result.Checksum
+
+	// the same rows have the same checksum, other rows another one
+	result, err = Run(context.Background(), bencher, Benchmark{Name: "loop", Type: TypeLoop, IterRatio: 1.0, Stmt: "3", Expect: Expect{Checksum: checksum}}, Options{Iter: 20, Threads: 4})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), result.FailedCount(), "%v", result.ErrorSamples())
+	assert.Equal(t, checksum, result.Checksum)
+	result, err = Run(context.Background(), bencher, Benchmark{Name: "other", Type: TypeOnce, Stmt: "4", Checksum: true}, Options{})
+	require.NoError(t, err)
+	assert.NotEqual(t, checksum, result.Checksum)
+
+	// executions returning other rows fail
+	result, err = Run(context.Background(), bencher, Benchmark{Name: "too many", Type: TypeOnce, Stmt: "4", Expect: Expect{Rows: &three}}, Options{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), result.ErrorCount)
+	assert.Equal(t, "expected 3 rows, got 4", result.ErrorSamples()[0].Message)
+	assert.Equal(t, uint64(0), result.RowCount)
+
+	result, err = Run(context.Background(), bencher, Benchmark{Name: "checksum", Type: TypeOnce, Stmt: "2", Expect: Expect{Checksum: checksum}}, Options{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), result.ErrorCount)
+	assert.Contains(t, result.ErrorSamples()[0].Message, "expected checksum "+checksum+", got ")
+}
@@ -0,0 +1,258 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histSubBits determines the precision of the histogram: every power of two range
+// is split into 2^histSubBits linear buckets, so values are recorded with a relative
+// error below 0.1%. Values below 2^histSubBits nanoseconds are recorded exactly.
+const histSubBits = 10
+
+// Histogram is a high dynamic range histogram of durations. Its memory usage only
+// depends on the magnitude of the largest recorded value, not on the number of
+// recorded values. The zero value is an empty histogram ready to use.
+// A Histogram is not safe for concurrent use, merge per goroutine histograms instead.
+type Histogram struct {
+	counts  []uint64
+	count   uint64
+	min     time.Duration
+	max     time.Duration
+	sum     time.Duration
+	sumLog2 float64
+}
+
+// bucketIndex returns the index of the bucket the given value is counted in.
+func bucketIndex(v int64) int {
+	if v < 1<<histSubBits {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - 1 - histSubBits
+	return (shift+1)<<histSubBits + int(v>>uint(shift)) - 1<<histSubBits
+}
+
+// bucketBounds returns the lowest and highest value counted in the given bucket.
+func bucketBounds(idx int) (int64, int64) {
+	if idx < 1<<histSubBits {
+		return int64(idx), int64(idx)
+	}
+	shift := uint(idx>>histSubBits - 1)
+	sub := int64(idx&(1<<histSubBits-1) + 1<<histSubBits)
+	return sub << shift, (sub+1)<<shift - 1
+}
+
+// Record adds a single duration to the histogram. Negative durations are recorded as 0.
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	idx := bucketIndex(int64(d))
+	if idx >= len(h.counts) {
+		grown := make([]uint64, idx+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[idx]++
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+	if d > 0 {
+		h.sumLog2 += math.Log2(float64(d))
+	}
+}
+
+// Merge adds all values recorded by o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.count == 0 {
+		return
+	}
+	if len(o.counts) > len(h.counts) {
+		grown := make([]uint64, len(o.counts))
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+
+	if h.count == 0 || o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+	h.count += o.count
+	h.sum += o.sum
+	h.sumLog2 += o.sumLog2
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+	return h.count
+}
+
+// Min returns the smallest recorded value.
+func (h *Histogram) Min() time.Duration {
+	if h == nil {
+		return 0
+	}
+	return h.min
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	if h == nil {
+		return 0
+	}
+	return h.max
+}
+
+// Sum returns the sum of all recorded values.
+func (h *Histogram) Sum() time.Duration {
+	if h == nil {
+		return 0
+	}
+	return h.sum
+}
+
+// Mean returns the arithmetic mean of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	if h.Count() == 0 {
+		return 0
+	}
+	return time.Duration(int64(h.sum) / int64(h.count))
+}
+
+// GeoMean returns the geometric mean of the recorded values.
+func (h *Histogram) GeoMean() time.Duration {
+	if h.Count() == 0 {
+		return 0
+	}
+	return time.Duration(math.Pow(2, h.sumLog2/float64(h.count)))
+}
+
+// ValueAt returns the value at or below which p percent of the recorded values are,
+// using the nearest-rank method. The result is exact up to the bucket precision.
+func (h *Histogram) ValueAt(p float64) time.Duration {
+	if h.Count() == 0 {
+		return 0
+	}
+	// the epsilon avoids rounding 99.9% of 1000 up to rank 1000
+	rank := uint64(math.Ceil(p/100*float64(h.count) - 1e-9))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank >= h.count {
+		return h.max
+	}
+
+	var seen uint64
+	for idx, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			_, highest := bucketBounds(idx)
+			v := time.Duration(highest)
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// Bucket is a non-empty histogram bucket, covering the values From to To (inclusive).
+type Bucket struct {
+	From  time.Duration `json:"from"`
+	To    time.Duration `json:"to"`
+	Count uint64        `json:"count"`
+}
+
+// Buckets returns all non-empty buckets in ascending order.
+func (h *Histogram) Buckets() []Bucket {
+	buckets := []Bucket{}
+	if h == nil {
+		return buckets
+	}
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		lowest, highest := bucketBounds(idx)
+		buckets = append(buckets, Bucket{From: time.Duration(lowest), To: time.Duration(highest), Count: c})
+	}
+	return buckets
+}
+
+// histogramJSON is the JSON representation of a histogram. Its percentiles are
+// included for convenience, they are derived from the buckets when decoding.
+type histogramJSON struct {
+	Count       uint64                   `json:"count"`
+	Min         time.Duration            `json:"min"`
+	Max         time.Duration            `json:"max"`
+	Sum         time.Duration            `json:"sum"`
+	Mean        time.Duration            `json:"mean"`
+	GeoMean     time.Duration            `json:"geoMean"`
+	Percentiles map[string]time.Duration `json:"percentiles"` // e.g. "p99.9"
+	Buckets     []Bucket                 `json:"buckets"`
+}
+
+// MarshalJSON encodes the histogram with its non-empty buckets.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	percentiles := map[string]time.Duration{}
+	for _, p := range Percentiles {
+		percentiles[fmt.Sprintf("p%v", p)] = h.ValueAt(p)
+	}
+	return json.Marshal(histogramJSON{
+		Count:       h.Count(),
+		Min:         h.Min(),
+		Max:         h.Max(),
+		Sum:         h.Sum(),
+		Mean:        h.Mean(),
+		GeoMean:     h.GeoMean(),
+		Percentiles: percentiles,
+		Buckets:     h.Buckets(),
+	})
+}
+
+// UnmarshalJSON restores a histogram encoded by MarshalJSON. The sum of the
+// logarithms is restored from the geometric mean, so it is slightly rounded.
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var j histogramJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*h = Histogram{count: j.Count, min: j.Min, max: j.Max, sum: j.Sum}
+	if j.GeoMean > 0 {
+		h.sumLog2 = math.Log2(float64(j.GeoMean)) * float64(j.Count)
+	}
+	for _, b := range j.Buckets {
+		idx := bucketIndex(int64(b.From))
+		if lowest, _ := bucketBounds(idx); lowest != int64(b.From) {
+			return fmt.Errorf("invalid histogram bucket starting at %v", int64(b.From))
+		}
+		if idx >= len(h.counts) {
+			grown := make([]uint64, idx+1)
+			copy(grown, h.counts)
+			h.counts = grown
+		}
+		h.counts[idx] += b.Count
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketIndex(t *testing.T) {
+	// every value has to be within the bounds of its bucket, buckets are contiguous
+	prevHighest := int64(-1)
+	for idx := 0; idx < 40<<histSubBits; idx++ {
+		lowest, highest := bucketBounds(idx)
+		require.Equal(t, prevHighest+1, lowest, "bucket %v", idx)
+		require.Equal(t, idx, bucketIndex(lowest), "lowest value of bucket %v", idx)
+		require.Equal(t, idx, bucketIndex(highest), "highest value of bucket %v", idx)
+		prevHighest = highest
+	}
+	assert.Less(t, bucketIndex(math.MaxInt64), 64<<histSubBits)
+}
+
+func TestHistogram(t *testing.T) {
+	// arrange
+	h := &Histogram{}
+
+	// act
+	for _, d := range []time.Duration{2 * time.Millisecond, 8 * time.Millisecond, 1 * time.Millisecond, 4 * time.Millisecond} {
+		h.Record(d)
+	}
+
+	// assert
+	assert.Equal(t, uint64(4), h.Count())
+	assert.Equal(t, 1*time.Millisecond, h.Min())
+	assert.Equal(t, 8*time.Millisecond, h.Max())
+	assert.Equal(t, 15*time.Millisecond, h.Sum())
+	assert.Equal(t, 3750*time.Microsecond, h.Mean())
+	assert.InEpsilon(t, float64(2828427*time.Nanosecond), float64(h.GeoMean()), 0.0001)
+	assert.InEpsilon(t, float64(2*time.Millisecond), float64(h.ValueAt(50)), 0.001)
+	assert.Equal(t, 8*time.Millisecond, h.ValueAt(100))
+	assert.Len(t, h.Buckets(), 4)
+}
+
+func TestHistogramMerge(t *testing.T) {
+	// arrange
+	a, b, all := &Histogram{}, &Histogram{}, &Histogram{}
+	for i := 1; i <= 10000; i++ {
+		d := time.Duration(i*i) * time.Nanosecond
+		if i%3 == 0 {
+			a.Record(d)
+		} else {
+			b.Record(d)
+		}
+		all.Record(d)
+	}
+
+	// act
+	merged := &Histogram{}
+	merged.Merge(a)
+	merged.Merge(b)
+	merged.Merge(nil)
+
+	// assert
+	assert.Equal(t, all.Count(), merged.Count())
+	assert.Equal(t, all.Min(), merged.Min())
+	assert.Equal(t, all.Max(), merged.Max())
+	assert.Equal(t, all.Sum(), merged.Sum())
+	assert.Equal(t, all.Buckets(), merged.Buckets())
+	for _, p := range Percentiles {
+		assert.Equal(t, all.ValueAt(p), merged.ValueAt(p))
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	var h *Histogram
+	assert.Equal(t, uint64(0), h.Count())
+	assert.Equal(t, time.Duration(0), h.Mean())
+	assert.Equal(t, time.Duration(0), h.GeoMean())
+	assert.Equal(t, time.Duration(0), h.ValueAt(99))
+	assert.Equal(t, []Bucket{}, h.Buckets())
+}
+
+func TestHistogramJSON(t *testing.T) {
+	h := &Histogram{}
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+
+	data, err := json.Marshal(h)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"p99.9":`)
+
+	got := &Histogram{}
+	require.NoError(t, json.Unmarshal(data, got))
+	assert.Equal(t, h.Count(), got.Count())
+	assert.Equal(t, h.Min(), got.Min())
+	assert.Equal(t, h.Max(), got.Max())
+	assert.Equal(t, h.Mean(), got.Mean())
+	assert.InDelta(t, int64(h.GeoMean()), int64(got.GeoMean()), 1)
+	for _, p := range Percentiles {
+		assert.Equal(t, h.ValueAt(p), got.ValueAt(p), "p%v", p)
+	}
+	assert.Equal(t, h.Buckets(), got.Buckets())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"count":1,"buckets":[{"from":2049,"to":2049,"count":1}]}`), got))
+}
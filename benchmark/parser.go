@@ -5,8 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template/parse"
+	"time"
+
+	"github.com/RomanBoegli/godbbench/statement"
 )
 
 var (
@@ -14,59 +21,241 @@ var (
 	ErrNoMode = errors.New("failed to parse \\benchmark line, missing mode")
 	// ErrNoName is raised when there is no token after \name.
 	ErrNoName = errors.New("missing name after \\name token")
+	// ErrNoDuration is raised when there is no token after \duration.
+	ErrNoDuration = errors.New("missing duration after \\duration token")
+	// ErrNoThreads is raised when there is no token after \threads.
+	ErrNoThreads = errors.New("missing number of threads after \\threads token")
+	// ErrNoIter is raised when there is no token after \iter.
+	ErrNoIter = errors.New("missing number of iterations after \\iter token")
+	// ErrNoWarmup is raised when there is no token after \warmup.
+	ErrNoWarmup = errors.New("missing iterations or duration after \\warmup token")
+	// ErrNoExpect is raised when there is no token after \expect.
+	ErrNoExpect = errors.New("missing rows=<n> or checksum=<hash> after \\expect token")
+	// ErrNoMixStmt is raised when a \mix benchmark contains statements before the first \stmt line.
+	ErrNoMixStmt = errors.New("missing \\stmt <name> <weight> line before the statements of a \\mix benchmark")
 )
 
 // Helper function to determine the benchmark name.
-func getName(benchmark Benchmark, start, line int) string {
+func getName(benchmark Benchmark, start, end linePos) string {
+	lines := fmt.Sprintf("%v-%v", start.n, end)
+	if start.file != end.file {
+		lines = fmt.Sprintf("%v to %v", start, end)
+	}
 	switch benchmark.Type {
 	case TypeLoop:
 		if benchmark.Name != "" {
 			return "(loop) " + benchmark.Name
 		}
-		return fmt.Sprintf("(loop) line %v-%v", start, line-1)
+		return "(loop) line " + lines
 	case TypeOnce:
 		if benchmark.Name != "" {
 			return "(once) " + benchmark.Name
 		}
-		return fmt.Sprintf("(once) line %v-%v", start, line-1)
+		return "(once) line " + lines
 	}
 	return "" // shouldn't happen
 }
 
+// linePos is the position of a line of a script. The file is empty for the
+// lines of the parsed script itself, otherwise it is the included file.
+type linePos struct {
+	file string
+	n    int
+}
+
+// String returns the line number, followed by the file if the line was included.
+func (p linePos) String() string {
+	if p.file == "" {
+		return strconv.Itoa(p.n)
+	}
+	return fmt.Sprintf("%v of %v", p.n, p.file)
+}
+
+// scriptLine is a line of a script with its position.
+type scriptLine struct {
+	text string
+	pos  linePos
+}
+
+// readScript reads the lines of a script, replacing each '\include <path>' line by the
+// lines of the included file. The path is relative to dir, the directory of the including
+// file. included are the files being included, a file including one of them is a cycle.
+func readScript(r io.Reader, file, dir string, included []string) ([]scriptLine, error) {
+	scanner := bufio.NewScanner(r)
+	lines := []scriptLine{}
+	for n := 1; scanner.Scan(); n++ {
+		pos := linePos{file: file, n: n}
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "\\include") {
+			lines = append(lines, scriptLine{text: line, pos: pos})
+			continue
+		}
+
+		path := strings.TrimSpace(strings.TrimPrefix(line, "\\include"))
+		if path == "" {
+			return nil, fmt.Errorf("failed to parse line %v, missing path after \\include", pos)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		path = filepath.Clean(path)
+		for i, f := range included {
+			if f == path {
+				cycle := append(append([]string{}, included[i:]...), path)
+				return nil, fmt.Errorf("failed to parse line %v, include cycle %v", pos, strings.Join(cycle, " -> "))
+			}
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to include file in line %v: %v", pos, err)
+		}
+		sub, err := readScript(f, path, filepath.Dir(path), append(append([]string{}, included...), path))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, sub...)
+	}
+	return lines, scanner.Err()
+}
+
+// ParseOptions are the options of ParseScriptWith.
+type ParseOptions struct {
+	// Dialect selects the \dialect sections of the script, e.g. "postgres", see
+	// DialectBencher. Without a dialect, only the shared parts of the script are parsed.
+	Dialect string
+	// Vars override the variables of the script set with '\set', e.g. given on the command line.
+	Vars map[string]string
+	// Path is the path of the script, the paths of its '\include' lines are relative
+	// to its directory. Without a path, they are relative to the working directory.
+	Path string
+}
+
 // ParseScript parses a benchmark script and returns the benchmarks.
+// Sections of specific dialects are skipped, see ParseScriptWith.
 func ParseScript(r io.Reader) ([]Benchmark, error) {
+	return ParseScriptWith(r, ParseOptions{})
+}
+
+// ParseScriptWith parses a benchmark script with the given options and returns the
+// benchmarks. A '\dialect <name>...' line starts a section only applying to the listed
+// dialects, up to the next '\dialect' line. '\dialect all' returns to the shared part
+// applying to all dialects. The lines of the sections of other dialects are skipped,
+// as if they were not there.
+//
+// A '\set <name> <value>' line sets a variable of the benchmarks whose '\benchmark' line
+// follows it, unless it is overridden by ParseOptions.Vars. The value is the rest of the
+// line. Statements before the first '\benchmark' line use the variables set before them.
+//
+// A '\include <path>' line is replaced by the lines of the file, errors refer to the
+// lines of the included file. Templates defined with {{define "name"}} in the statements
+// of any benchmark can be used in all of them with {{template "name" .}}, a benchmark
+// consisting of nothing but such definitions isn't executed itself.
+func ParseScriptWith(r io.Reader, opts ParseOptions) ([]Benchmark, error) {
+	included := []string{}
+	if opts.Path != "" {
+		included = append(included, filepath.Clean(opts.Path))
+	}
+	lines, err := readScript(r, "", filepath.Dir(opts.Path), included)
+	if err != nil {
+		return []Benchmark{}, err
+	}
+
 	var (
-		scanner    = bufio.NewScanner(r)
-		loopStart  = 1             // line the current loop mode started
-		lineN      = 1             // current line number
+		loopStart  = 0             // index of the line the current loop mode started
 		benchmarks = []Benchmark{} // the result
 		curBench   = Benchmark{Type: TypeLoop, Parallel: false, IterRatio: 1.0}
+		inMix      = false // whether the current benchmark is a \mix of weighted statements
+		skip       = false // whether the current \dialect section is one of another dialect
+		vars       Vars    // variables of the following benchmarks, copied on every change
+		headed     = false // whether a '\benchmark' line was parsed yet
 	)
 
-	// Helper function to append a new loop benchmark
-	flushLoop := func() {
-		if curBench.Stmt != "" {
+	if len(opts.Vars) > 0 {
+		vars = Vars{}
+		for name, value := range opts.Vars {
+			vars[name] = ParseVar(value)
+		}
+	}
+	curBench.Vars = vars
+
+	// Helper function to append a new loop benchmark, end is the index of its last line
+	flushLoop := func(end int) error {
+		if curBench.Stmt != "" || len(curBench.Mix) > 0 {
 			curBench.Stmt = strings.TrimSuffix(curBench.Stmt, "\n")
-			curBench.Name = getName(curBench, loopStart, lineN)
+			for i := range curBench.Mix {
+				curBench.Mix[i].Stmt = strings.TrimSuffix(curBench.Mix[i].Stmt, "\n")
+				if curBench.Mix[i].Stmt == "" {
+					return fmt.Errorf("\\stmt %v of the \\mix benchmark in line %v has no statements", curBench.Mix[i].Name, lines[loopStart-1].pos)
+				}
+			}
+			curBench.Name = getName(curBench, lines[loopStart].pos, lines[end].pos)
 			benchmarks = append(benchmarks, curBench)
 
 			// Start new empty benchmark
 			curBench = Benchmark{IterRatio: 1.0}
 		}
+		inMix = false
+		return nil
 	}
 
 	// Parse each line of the script file
-	for ; scanner.Scan(); lineN++ {
-		line := strings.TrimSpace(scanner.Text())
+	for idx, l := range lines {
+		line, lineN := l.text, l.pos
 
 		// Skip comments and empty lines.
 		if strings.HasPrefix(line, "--") || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") || line == "" {
 			continue
 		}
 
+		// Parse '\dialect <name>...' command, starting a section of the listed dialects.
+		if strings.HasPrefix(line, "\\dialect") {
+			names := strings.Fields(line)[1:]
+			if len(names) == 0 {
+				return []Benchmark{}, fmt.Errorf("failed to parse line %v, missing dialect after \\dialect", lineN)
+			}
+			skip = true
+			for _, name := range names {
+				if _, ok := statement.Dialects[name]; !ok && name != "all" {
+					return []Benchmark{}, fmt.Errorf("failed to parse line %v, unknown dialect %q", lineN, name)
+				}
+				if name == "all" || name == opts.Dialect {
+					skip = false
+				}
+			}
+			continue
+		}
+		if skip {
+			continue
+		}
+
+		// Parse '\set <name> <value>' command, setting a variable of the following benchmarks.
+		if strings.HasPrefix(line, "\\set") {
+			rest := strings.TrimSpace(strings.TrimPrefix(line, "\\set"))
+			i := strings.IndexAny(rest, " \t")
+			if i < 0 {
+				return []Benchmark{}, fmt.Errorf("failed to parse line %v, expected \\set <name> <value>", lineN)
+			}
+			name := rest[:i]
+			if _, ok := opts.Vars[name]; !ok {
+				// the benchmarks before keep the variables as they were
+				next := Vars{}
+				for n, v := range vars {
+					next[n] = v
+				}
+				next[name] = ParseVar(strings.TrimSpace(rest[i:]))
+				vars = next
+			}
+			if !headed && curBench.Stmt == "" {
+				curBench.Vars = vars
+			}
+			continue
+		}
+
 		// Parse '\benchmark' command.
 		if strings.HasPrefix(line, "\\benchmark") {
-			tokens := strings.Split(line, " ")
+			tokens := strings.Fields(line)
 
 			// remove '\benchmark' entry from tokens
 			tokens = tokens[1:]
@@ -79,44 +268,103 @@ func ParseScript(r io.Reader) ([]Benchmark, error) {
 			// parse benchmark mode 'once' or 'loop'
 			switch tokens[0] {
 			case "once":
-				if curBench.Type == TypeLoop {
-					flushLoop()
+				if err := flushLoop(idx - 1); err != nil {
+					return []Benchmark{}, err
 				}
 				curBench.Type = TypeOnce
-				loopStart = lineN + 1
+				loopStart = idx + 1
 			case "loop":
-				flushLoop()
+				if err := flushLoop(idx - 1); err != nil {
+					return []Benchmark{}, err
+				}
 				curBench.Type = TypeLoop
-				loopStart = lineN + 1
+				loopStart = idx + 1
 			default:
 				return []Benchmark{}, fmt.Errorf("failed to parse mode, neither 'once' nor 'loop': %v", tokens[0])
 			}
+			curBench.Vars = vars
+			headed = true
 
 			if len(tokens) > 1 && !strings.HasPrefix(tokens[1], "\\") {
 				// custom execution count ratio specified
 				if curBench.Type == TypeLoop {
-					ratio, _ := strconv.ParseFloat(tokens[1], 32)
-					if ratio > 0.0 && ratio <= 1.0 {
-						curBench.IterRatio = ratio
+					ratio, err := strconv.ParseFloat(tokens[1], 64)
+					if err != nil || ratio <= 0 {
+						return []Benchmark{}, fmt.Errorf("failed to parse iteration ratio in line %v, must be a number > 0: %q", lineN, tokens[1])
 					}
+					curBench.IterRatio = ratio
 				}
 				tokens = tokens[2:]
 			} else {
 				tokens = tokens[1:]
 			}
 
-			// Parse remaining tokens
-			for _, t := range tokens {
-				// reminder: can't change 'tokens' inside the range, e.g. 'cutting' with tokens[2:]
-				// so we have to iterate even the token after \name, which could be skipped otherwise.
-				switch t {
+			// Parse remaining tokens, options with a value consume the following token
+			for j := 0; j < len(tokens); j++ {
+				switch tokens[j] {
 				case "\\parallel":
 					curBench.Parallel = true
+				case "\\mix":
+					if curBench.Type != TypeLoop {
+						return []Benchmark{}, fmt.Errorf("failed to parse line %v, \\mix requires mode 'loop'", lineN)
+					}
+					inMix = true
 				case "\\name":
-					if len(tokens) < 2 {
+					if j+1 >= len(tokens) {
 						return []Benchmark{}, ErrNoName
 					}
-					curBench.Name = tokens[1]
+					j++
+					curBench.Name = tokens[j]
+				case "\\duration":
+					if j+1 >= len(tokens) {
+						return []Benchmark{}, ErrNoDuration
+					}
+					j++
+					d, err := time.ParseDuration(tokens[j])
+					if err != nil || d <= 0 {
+						return []Benchmark{}, fmt.Errorf("failed to parse duration in line %v: %q", lineN, tokens[j])
+					}
+					curBench.Duration = d
+				case "\\threads":
+					if j+1 >= len(tokens) {
+						return []Benchmark{}, ErrNoThreads
+					}
+					j++
+					n, err := strconv.Atoi(tokens[j])
+					if err != nil || n <= 0 {
+						return []Benchmark{}, fmt.Errorf("failed to parse threads in line %v, must be a number > 0: %q", lineN, tokens[j])
+					}
+					curBench.Threads = n
+				case "\\iter":
+					if j+1 >= len(tokens) {
+						return []Benchmark{}, ErrNoIter
+					}
+					j++
+					n, err := strconv.Atoi(tokens[j])
+					if err != nil || n <= 0 {
+						return []Benchmark{}, fmt.Errorf("failed to parse iterations in line %v, must be a number > 0: %q", lineN, tokens[j])
+					}
+					curBench.Iter = n
+				case "\\warmup":
+					if j+1 >= len(tokens) {
+						return []Benchmark{}, ErrNoWarmup
+					}
+					j++
+					w, err := ParseWarmup(tokens[j])
+					if err != nil {
+						return []Benchmark{}, fmt.Errorf("failed to parse warm-up in line %v: %v", lineN, err)
+					}
+					curBench.Warmup = w
+				case "\\expect":
+					if j+1 >= len(tokens) {
+						return []Benchmark{}, ErrNoExpect
+					}
+					j++
+					if err := curBench.Expect.Set(tokens[j]); err != nil {
+						return []Benchmark{}, fmt.Errorf("failed to parse expectation in line %v: %v", lineN, err)
+					}
+				case "\\checksum":
+					curBench.Checksum = true
 				}
 			}
 
@@ -124,18 +372,88 @@ func ParseScript(r io.Reader) ([]Benchmark, error) {
 			continue
 		}
 
+		// Parse '\stmt <name> <weight>' command, starting a statement of a '\mix' benchmark.
+		if strings.HasPrefix(line, "\\stmt") {
+			tokens := strings.Fields(line)
+			if !inMix {
+				return []Benchmark{}, fmt.Errorf("failed to parse line %v, \\stmt outside of a \\mix benchmark", lineN)
+			}
+			if len(tokens) != 3 {
+				return []Benchmark{}, fmt.Errorf("failed to parse line %v, expected \\stmt <name> <weight>", lineN)
+			}
+			weight, err := strconv.ParseFloat(tokens[2], 64)
+			if err != nil || weight <= 0 {
+				return []Benchmark{}, fmt.Errorf("failed to parse line %v, weight must be a number > 0: %v", lineN, tokens[2])
+			}
+			curBench.Mix = append(curBench.Mix, MixStmt{Name: tokens[1], Weight: weight})
+			continue
+		}
+
 		// Neither a '\benchmark' nor '\name' command line.
 		// Should be an SQL statement line.
-		// Append the line either as benchmark type once or loop
+		// Append the line either as benchmark type once or loop, or to the current statement of a mix
+		if inMix {
+			if len(curBench.Mix) == 0 {
+				return []Benchmark{}, ErrNoMixStmt
+			}
+			curBench.Mix[len(curBench.Mix)-1].Stmt += line + "\n"
+			continue
+		}
 		curBench.Stmt += line + "\n"
 	}
 
 	// reached the end of the file, append remaining loop statements to benchmark
-	if curBench.Stmt != "" {
-		curBench.Stmt = strings.TrimSuffix(curBench.Stmt, "\n")
-		curBench.Name = getName(curBench, loopStart, lineN)
-		benchmarks = append(benchmarks, curBench)
+	if err := flushLoop(len(lines) - 1); err != nil {
+		return []Benchmark{}, err
+	}
+
+	return shareDefinitions(benchmarks)
+}
+
+// shareDefinitions collects the templates defined with {{define "name"}} in the statements
+// of all benchmarks and passes them to every benchmark, see Benchmark.Defines. Benchmarks
+// consisting of nothing but definitions are removed.
+func shareDefinitions(benchmarks []Benchmark) ([]Benchmark, error) {
+	definedIn := map[string]string{} // benchmark defining each template
+	defines := &strings.Builder{}
+	kept := []Benchmark{}
+	for _, b := range benchmarks {
+		stmts := []string{b.Stmt}
+		for _, m := range b.Mix {
+			stmts = append(stmts, m.Stmt)
+		}
+
+		empty := len(b.Mix) == 0
+		for _, stmt := range stmts {
+			t, err := newTemplate(b.Name, "", stmt)
+			if err != nil {
+				return []Benchmark{}, fmt.Errorf("failed to parse the statements of %v: %v", b.Name, err)
+			}
+			names := []string{}
+			for _, d := range t.Templates() {
+				if d.Name() != t.Name() {
+					names = append(names, d.Name())
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if other, ok := definedIn[name]; ok {
+					return []Benchmark{}, fmt.Errorf("template %q of %v is already defined in %v", name, b.Name, other)
+				}
+				definedIn[name] = b.Name
+				fmt.Fprintf(defines, "{{define %q}}%v{{end}}", name, t.Lookup(name).Tree.Root)
+			}
+			if t.Tree != nil && !parse.IsEmptyTree(t.Tree.Root) {
+				empty = false
+			}
+		}
+		if !empty {
+			kept = append(kept, b)
+		}
 	}
 
-	return benchmarks, nil
+	for i := range kept {
+		kept[i].Defines = defines.String()
+	}
+	return kept, nil
 }
@@ -2,8 +2,13 @@ package benchmark
 
 import (
 	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -44,6 +49,134 @@ func TestParseScript(t *testing.T) {
 				err:        ErrNoName,
 			},
 		},
+		{
+			description: "fail/missing duration",
+			in:          "\\benchmark loop \\duration",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        ErrNoDuration,
+			},
+		},
+		{
+			description: "fail/invalid duration",
+			in:          "\\benchmark loop \\duration 30",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse duration in line 1: \"30\""),
+			},
+		},
+		{
+			description: "fail/missing threads",
+			in:          "\\benchmark loop \\threads",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        ErrNoThreads,
+			},
+		},
+		{
+			description: "fail/invalid threads",
+			in:          "\\benchmark loop \\threads 0",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse threads in line 1, must be a number > 0: \"0\""),
+			},
+		},
+		{
+			description: "fail/missing iter",
+			in:          "\\benchmark loop \\iter",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        ErrNoIter,
+			},
+		},
+		{
+			description: "fail/invalid iter",
+			in:          "\\benchmark loop \\iter many",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse iterations in line 1, must be a number > 0: \"many\""),
+			},
+		},
+		{
+			description: "fail/invalid ratio",
+			in:          "\\benchmark loop -1",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse iteration ratio in line 1, must be a number > 0: \"-1\""),
+			},
+		},
+		{
+			description: "fail/missing warmup",
+			in:          "\\benchmark loop \\warmup",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        ErrNoWarmup,
+			},
+		},
+		{
+			description: "fail/invalid warmup",
+			in:          "\\benchmark loop \\warmup soon",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse warm-up in line 1: invalid warm-up \"soon\", neither a number of iterations nor a duration"),
+			},
+		},
+		{
+			description: "fail/missing expectation",
+			in:          "\\benchmark once \\expect",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        ErrNoExpect,
+			},
+		},
+		{
+			description: "fail/invalid expectation",
+			in:          "\\benchmark once \\expect rows=ten",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse expectation in line 1: invalid number of rows \"ten\""),
+			},
+		},
+		{
+			description: "fail/mix statement without name",
+			in:          "\\benchmark loop \\mix\nSELECT ...;",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        ErrNoMixStmt,
+			},
+		},
+		{
+			description: "fail/stmt outside of mix",
+			in:          "\\benchmark loop\n\\stmt select 1",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse line 2, \\stmt outside of a \\mix benchmark"),
+			},
+		},
+		{
+			description: "fail/invalid mix weight",
+			in:          "\\benchmark loop \\mix\n\\stmt select 0",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse line 2, weight must be a number > 0: 0"),
+			},
+		},
+		{
+			description: "fail/once mix",
+			in:          "\\benchmark once \\mix",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("failed to parse line 1, \\mix requires mode 'loop'"),
+			},
+		},
+		{
+			description: "fail/empty mix statement",
+			in:          "\\benchmark loop \\mix\n\\stmt select 1",
+			expect: expect{
+				benchmarks: []Benchmark{},
+				err:        errors.New("\\stmt select of the \\mix benchmark in line 1 has no statements"),
+			},
+		},
 		{
 			description: "one statement",
 			in:          "INSERT INTO ...;",
@@ -288,6 +421,135 @@ func TestParseScript(t *testing.T) {
 				},
 			},
 		},
+		{
+			// each once block is a benchmark of its own, they aren't merged into one
+			description: "consecutive once blocks",
+			in: `
+				\benchmark once \name create_index
+				CREATE INDEX index_boss_id ON employee (boss_id);
+				-- CACHE
+				\benchmark once \name clear_cache
+				DISCARD ALL;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(once) create_index", Type: TypeOnce, IterRatio: 1.0, Stmt: "CREATE INDEX index_boss_id ON employee (boss_id);"},
+					{Name: "(once) clear_cache", Type: TypeOnce, IterRatio: 1.0, Stmt: "DISCARD ALL;"},
+				},
+			},
+		},
+		{
+			description: "parallel/once blocks",
+			in: `
+				\benchmark once \parallel \name read
+				SELECT ...;
+				\benchmark once \parallel \name write
+				UPDATE ...;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(once) read", Type: TypeOnce, Parallel: true, IterRatio: 1.0, Stmt: "SELECT ...;"},
+					{Name: "(once) write", Type: TypeOnce, Parallel: true, IterRatio: 1.0, Stmt: "UPDATE ...;"},
+				},
+			},
+		},
+		{
+			description: "parallel/set name",
+			in: `
+				\benchmark loop \parallel \name insert
+				INSERT INTO ...;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(loop) insert", Type: TypeLoop, Parallel: true, IterRatio: 1.0, Stmt: "INSERT INTO ...;"},
+				},
+			},
+		},
+		{
+			description: "warmup",
+			in: `
+				\benchmark loop \warmup 100 \name select
+				SELECT ...;
+				\benchmark loop \name insert \warmup 5s
+				INSERT INTO ...;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(loop) select", Type: TypeLoop, IterRatio: 1.0, Warmup: Warmup{Iter: 100}, Stmt: "SELECT ...;"},
+					{Name: "(loop) insert", Type: TypeLoop, IterRatio: 1.0, Warmup: Warmup{Duration: 5 * time.Second}, Stmt: "INSERT INTO ...;"},
+				},
+			},
+		},
+		{
+			description: "threads and iter",
+			in: `
+				\benchmark loop \threads 1 \name insert
+				INSERT INTO ...;
+				\benchmark loop 2.5 \name select \threads 64
+				SELECT ...;
+				\benchmark loop \iter 100 \name update
+				UPDATE ...;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(loop) insert", Type: TypeLoop, IterRatio: 1.0, Threads: 1, Stmt: "INSERT INTO ...;"},
+					{Name: "(loop) select", Type: TypeLoop, IterRatio: 2.5, Threads: 64, Stmt: "SELECT ...;"},
+					{Name: "(loop) update", Type: TypeLoop, IterRatio: 1.0, Iter: 100, Stmt: "UPDATE ...;"},
+				},
+			},
+		},
+		{
+			description: "duration",
+			in: `
+				\benchmark loop \duration 30s \name select
+				SELECT ...;
+				\benchmark loop 0.5  \name insert   \duration 1m30s
+				INSERT INTO ...;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(loop) select", Type: TypeLoop, IterRatio: 1.0, Duration: 30 * time.Second, Stmt: "SELECT ...;"},
+					{Name: "(loop) insert", Type: TypeLoop, IterRatio: 0.5, Duration: 90 * time.Second, Stmt: "INSERT INTO ...;"},
+				},
+			},
+		},
+		{
+			description: "expect",
+			in: `
+				\benchmark once \name count \expect rows=1 \expect checksum=00FF
+				SELECT COUNT(*) ...;
+				\benchmark once \checksum \name top \expect rows=0
+				SELECT ... LIMIT 10;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(once) count", Type: TypeOnce, IterRatio: 1.0, Expect: Expect{Rows: uint64Ptr(1), Checksum: "00ff"}, Stmt: "SELECT COUNT(*) ...;"},
+					{Name: "(once) top", Type: TypeOnce, IterRatio: 1.0, Checksum: true, Expect: Expect{Rows: uint64Ptr(0)}, Stmt: "SELECT ... LIMIT 10;"},
+				},
+			},
+		},
+		{
+			description: "mix",
+			in: `
+				\benchmark loop \mix \name oltp
+				\stmt select 7
+				SELECT ...;
+				\stmt update 2.5
+				UPDATE ...;
+				UPDATE ...;
+				\benchmark once
+				DROP ...;
+				`,
+			expect: expect{
+				benchmarks: []Benchmark{
+					{Name: "(loop) oltp", Type: TypeLoop, IterRatio: 1.0, Mix: []MixStmt{
+						{Name: "select", Weight: 7, Stmt: "SELECT ...;"},
+						{Name: "update", Weight: 2.5, Stmt: "UPDATE ...;\nUPDATE ...;"},
+					}},
+					{Name: "(once) line 9-10", Type: TypeOnce, IterRatio: 1.0, Stmt: "DROP ...;"},
+				},
+			},
+		},
 	}
 
 	for _, tt := range testCases {
@@ -303,3 +565,177 @@ func TestParseScript(t *testing.T) {
 		})
 	}
 }
+
+func TestParseScriptDialect(t *testing.T) {
+	script := `
+		\benchmark once \name init
+		\dialect postgres
+		CREATE TABLE t (id SERIAL PRIMARY KEY);
+		\dialect mysql sqlite
+		CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY);
+		\dialect all
+		INSERT INTO t VALUES (1);
+
+		\dialect cypher
+		\benchmark loop \name match
+		MATCH (n) RETURN n;
+		\dialect all
+
+		\benchmark once \name clean
+		DROP TABLE t;
+		`
+
+	testCases := []struct {
+		dialect    string
+		benchmarks []Benchmark
+	}{
+		{"postgres", []Benchmark{
+			{Name: "(once) init", Type: TypeOnce, IterRatio: 1.0, Stmt: "CREATE TABLE t (id SERIAL PRIMARY KEY);\nINSERT INTO t VALUES (1);"},
+			{Name: "(once) clean", Type: TypeOnce, IterRatio: 1.0, Stmt: "DROP TABLE t;"},
+		}},
+		{"sqlite", []Benchmark{
+			{Name: "(once) init", Type: TypeOnce, IterRatio: 1.0, Stmt: "CREATE TABLE t (id INT AUTO_INCREMENT PRIMARY KEY);\nINSERT INTO t VALUES (1);"},
+			{Name: "(once) clean", Type: TypeOnce, IterRatio: 1.0, Stmt: "DROP TABLE t;"},
+		}},
+		{"cypher", []Benchmark{
+			{Name: "(once) init", Type: TypeOnce, IterRatio: 1.0, Stmt: "INSERT INTO t VALUES (1);"},
+			{Name: "(loop) match", Type: TypeLoop, IterRatio: 1.0, Stmt: "MATCH (n) RETURN n;"},
+			{Name: "(once) clean", Type: TypeOnce, IterRatio: 1.0, Stmt: "DROP TABLE t;"},
+		}},
+		// without a dialect, only the shared parts remain
+		{"", []Benchmark{
+			{Name: "(once) init", Type: TypeOnce, IterRatio: 1.0, Stmt: "INSERT INTO t VALUES (1);"},
+			{Name: "(once) clean", Type: TypeOnce, IterRatio: 1.0, Stmt: "DROP TABLE t;"},
+		}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.dialect, func(t *testing.T) {
+			got, err := ParseScriptWith(strings.NewReader(script), ParseOptions{Dialect: tt.dialect})
+			require.NoError(t, err)
+			require.Equal(t, tt.benchmarks, got)
+		})
+	}
+
+	_, err := ParseScriptWith(strings.NewReader("\\dialect oracle\nSELECT 1;"), ParseOptions{Dialect: "postgres"})
+	require.EqualError(t, err, `failed to parse line 1, unknown dialect "oracle"`)
+	_, err = ParseScriptWith(strings.NewReader("SELECT 1;\n\\dialect"), ParseOptions{Dialect: "postgres"})
+	require.EqualError(t, err, "failed to parse line 2, missing dialect after \\dialect")
+}
+
+func TestParseScriptVars(t *testing.T) {
+	script := `
+		\set rows 1000
+		INSERT INTO t SELECT * FROM generate_series(1, {{.Vars.rows}});
+
+		\set name it's a test
+		\set ratio 0.5
+		\benchmark loop \name select
+		SELECT * FROM t WHERE id = {{call .RandIntBetween 1 .Vars.rows}} AND name = '{{.Vars.name}}';
+
+		\set rows 10
+		\benchmark once \name clean
+		DELETE FROM t;
+		`
+
+	got, err := ParseScriptWith(strings.NewReader(script), ParseOptions{})
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	require.Equal(t, Vars{"rows": 1000}, got[0].Vars)
+	require.Equal(t, Vars{"rows": 1000, "name": "it's a test", "ratio": 0.5}, got[1].Vars)
+	require.Equal(t, Vars{"rows": 10, "name": "it's a test", "ratio": 0.5}, got[2].Vars)
+
+	// variables given on the command line override those of the script
+	got, err = ParseScriptWith(strings.NewReader(script), ParseOptions{Vars: map[string]string{"rows": "5", "limit": "1"}})
+	require.NoError(t, err)
+	require.Equal(t, Vars{"rows": 5, "limit": 1}, got[0].Vars)
+	require.Equal(t, Vars{"rows": 5, "limit": 1, "name": "it's a test", "ratio": 0.5}, got[2].Vars)
+
+	_, err = ParseScript(strings.NewReader("\\set rows"))
+	require.EqualError(t, err, "failed to parse line 1, expected \\set <name> <value>")
+}
+
+func TestParseScriptInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	parse := func(path string) ([]Benchmark, error) {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		return ParseScriptWith(f, ParseOptions{Path: path})
+	}
+
+	write("common/init.sql", "\\benchmark once \\name init\nCREATE TABLE t (id INT);\n\\include clean.sql")
+	write("common/clean.sql", "\\benchmark once\nDROP TABLE t;")
+	main := write("main.sql", "\\include common/init.sql\n\\benchmark loop \\name insert\nINSERT INTO t VALUES ({{.Iter}});\n")
+
+	got, err := parse(main)
+	require.NoError(t, err)
+	require.Equal(t, []Benchmark{
+		{Name: "(once) init", Type: TypeOnce, IterRatio: 1.0, Stmt: "CREATE TABLE t (id INT);"},
+		{Name: "(once) line 2-2 of " + filepath.Join(dir, "common", "clean.sql"), Type: TypeOnce, IterRatio: 1.0, Stmt: "DROP TABLE t;"},
+		{Name: "(loop) insert", Type: TypeLoop, IterRatio: 1.0, Stmt: "INSERT INTO t VALUES ({{.Iter}});"},
+	}, got)
+
+	// errors refer to the line of the included file
+	write("common/clean.sql", "\\benchmark once\nDROP TABLE t;\n\\benchmark loop \\duration forever")
+	_, err = parse(main)
+	require.EqualError(t, err, `failed to parse duration in line 3 of `+filepath.Join(dir, "common", "clean.sql")+`: "forever"`)
+
+	write("common/clean.sql", "\\include ../main.sql")
+	_, err = parse(main)
+	require.EqualError(t, err, "failed to parse line 1 of "+filepath.Join(dir, "common", "clean.sql")+", include cycle "+
+		strings.Join([]string{main, filepath.Join(dir, "common", "init.sql"), filepath.Join(dir, "common", "clean.sql"), main}, " -> "))
+
+	write("common/clean.sql", "\\include missing.sql")
+	_, err = parse(main)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to include file in line 1 of "+filepath.Join(dir, "common", "clean.sql"))
+}
+
+func TestParseScriptDefine(t *testing.T) {
+	got, err := ParseScript(strings.NewReader(`
+		{{define "table"}}account_{{.Vars.n}}{{end}}
+		{{define "balance"}}{{call .RandIntBetween 1 100}}{{end}}
+
+		\set n 1
+		\benchmark loop \name insert
+		INSERT INTO {{template "table" .}} (id, balance) VALUES ({{.Iter}}, {{template "balance" .}});
+
+		\benchmark once \name count
+		{{define "count"}}SELECT COUNT(*) FROM {{template "table" .}}{{end}}
+		{{template "count" .}};
+		`))
+	require.NoError(t, err)
+
+	// the block of definitions isn't a benchmark of its own
+	require.Len(t, got, 2)
+	require.Equal(t, got[0].Defines, got[1].Defines)
+
+	tmpl, err := newTemplate(got[1].Name, got[1].Defines, got[1].Stmt)
+	require.NoError(t, err)
+	stmt, err := buildStmt(tmpl, 1, got[1].Vars, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	require.Equal(t, "SELECT COUNT(*) FROM account_1;", strings.TrimSpace(stmt))
+	tmpl, err = newTemplate(got[0].Name, got[0].Defines, got[0].Stmt)
+	require.NoError(t, err)
+	stmt, err = buildStmt(tmpl, 7, got[0].Vars, rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	require.Regexp(t, `^INSERT INTO account_1 \(id, balance\) VALUES \(7, \d+\);$`, stmt)
+
+	_, err = ParseScript(strings.NewReader("\\benchmark once \\name a\n{{define \"x\"}}1{{end}}\n\\benchmark once \\name b\n{{define \"x\"}}2{{end}}"))
+	require.EqualError(t, err, `template "x" of (once) b is already defined in (once) a`)
+	_, err = ParseScript(strings.NewReader("\\benchmark once \\name a\nSELECT {{template \"x\" .}"))
+	require.Error(t, err)
+}
+
+func uint64Ptr(n uint64) *uint64 {
+	return &n
+}
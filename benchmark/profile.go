@@ -0,0 +1,84 @@
+package benchmark
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadProfile increases the concurrency of a loop benchmark in stages, from
+// From to To threads. Each stage runs for Hold, or for the usual number of
+// iterations if Hold is 0. The zero value disables the profile.
+type LoadProfile struct {
+	From int
+	To   int
+	Step int
+	Hold time.Duration
+}
+
+// ParseLoadProfile parses a load profile in the format "from:to[:option,...]",
+// the options being "step=N" (default 1) and "hold=DURATION", e.g. "1:64:step=8,hold=20s".
+func ParseLoadProfile(s string) (LoadProfile, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 {
+		return LoadProfile{}, fmt.Errorf("invalid load profile %q, expected from:to[:step=N,hold=DURATION]", s)
+	}
+
+	p := LoadProfile{Step: 1}
+	var err error
+	if p.From, err = strconv.Atoi(parts[0]); err != nil || p.From < 1 {
+		return LoadProfile{}, fmt.Errorf("invalid load profile %q, start must be a number of threads > 0", s)
+	}
+	if p.To, err = strconv.Atoi(parts[1]); err != nil || p.To < p.From {
+		return LoadProfile{}, fmt.Errorf("invalid load profile %q, end must be a number of threads >= %v", s, p.From)
+	}
+
+	if len(parts) == 3 {
+		for _, option := range strings.Split(parts[2], ",") {
+			kv := strings.SplitN(option, "=", 2)
+			if len(kv) != 2 {
+				return LoadProfile{}, fmt.Errorf("invalid load profile option %q, expected key=value", option)
+			}
+			switch kv[0] {
+			case "step":
+				if p.Step, err = strconv.Atoi(kv[1]); err != nil || p.Step < 1 {
+					return LoadProfile{}, fmt.Errorf("invalid load profile step %q", kv[1])
+				}
+			case "hold":
+				if p.Hold, err = time.ParseDuration(kv[1]); err != nil || p.Hold <= 0 {
+					return LoadProfile{}, fmt.Errorf("invalid load profile hold %q", kv[1])
+				}
+			default:
+				return LoadProfile{}, fmt.Errorf("unknown load profile option %q", kv[0])
+			}
+		}
+	}
+	return p, nil
+}
+
+// IsZero reports whether the load profile is disabled.
+func (p LoadProfile) IsZero() bool {
+	return p.From <= 0
+}
+
+// Stages returns the number of threads of each stage. After the first stage,
+// the number of threads is increased to the next multiple of Step, the last
+// stage always runs with To threads, e.g. 1:64:step=8 yields 1, 8, 16, ..., 64.
+func (p LoadProfile) Stages() []int {
+	if p.IsZero() {
+		return nil
+	}
+	step := p.Step
+	if step < 1 {
+		step = 1
+	}
+	stages := []int{p.From}
+	for threads := (p.From/step + 1) * step; threads < p.To; threads += step {
+		stages = append(stages, threads)
+	}
+	if p.To > p.From {
+		stages = append(stages, p.To)
+	}
+	return stages
+}
@@ -0,0 +1,38 @@
+package benchmark
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLoadProfile(t *testing.T) {
+	testCases := []struct {
+		in         string
+		wantErr    error
+		want       LoadProfile
+		wantStages []int
+	}{
+		{in: "1:64:step=8,hold=20s", want: LoadProfile{From: 1, To: 64, Step: 8, Hold: 20 * time.Second}, wantStages: []int{1, 8, 16, 24, 32, 40, 48, 56, 64}},
+		{in: "4:10:step=4", want: LoadProfile{From: 4, To: 10, Step: 4}, wantStages: []int{4, 8, 10}},
+		{in: "2:4", want: LoadProfile{From: 2, To: 4, Step: 1}, wantStages: []int{2, 3, 4}},
+		{in: "8:8:hold=1m", want: LoadProfile{From: 8, To: 8, Step: 1, Hold: time.Minute}, wantStages: []int{8}},
+		{in: "8", wantErr: errors.New("invalid load profile \"8\", expected from:to[:step=N,hold=DURATION]")},
+		{in: "0:8", wantErr: errors.New("invalid load profile \"0:8\", start must be a number of threads > 0")},
+		{in: "8:4", wantErr: errors.New("invalid load profile \"8:4\", end must be a number of threads >= 8")},
+		{in: "1:4:step=0", wantErr: errors.New("invalid load profile step \"0\"")},
+		{in: "1:4:hold", wantErr: errors.New("invalid load profile option \"hold\", expected key=value")},
+		{in: "1:4:wait=1s", wantErr: errors.New("unknown load profile option \"wait\"")},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLoadProfile(tt.in)
+			require.Equal(t, tt.wantErr, err)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.wantStages, got.Stages())
+		})
+	}
+}
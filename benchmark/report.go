@@ -0,0 +1,94 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ReportVersion is the version of the schema of the JSON report. It is increased
+// whenever a field is removed or changes its meaning, fields may be added anytime.
+const ReportVersion = 1
+
+// Report is the JSON document of a run. Besides the results, it contains everything
+// needed to reproduce and compare them: the environment, the effective flags and
+// the hash of the script.
+type Report struct {
+	Version       int               `json:"version"` // see ReportVersion
+	System        string            `json:"system"`  // subcommand, e.g. "postgres"
+	ServerVersion string            `json:"serverVersion,omitempty"`
+	Start         time.Time         `json:"start"`
+	End           time.Time         `json:"end"`
+	Host          string            `json:"host,omitempty"` // name of the machine running the benchmarks
+	OS            string            `json:"os"`
+	Arch          string            `json:"arch"`
+	GoVersion     string            `json:"goVersion"`
+	GitCommit     string            `json:"gitCommit,omitempty"` // commit checked out in the working directory
+	Drivers       map[string]string `json:"drivers,omitempty"`   // versions of the database driver modules
+	Flags         map[string]string `json:"flags"`               // effective value of every flag, passwords redacted
+	Script        *ReportScript     `json:"script,omitempty"`    // custom script, nil for the built-in benchmarks
+	Results       []ReportResult    `json:"results"`
+	Summaries     []ReportSummary   `json:"summaries,omitempty"` // statistics over the runs, only with --repeat
+}
+
+// ReportScript identifies the script of a run.
+type ReportScript struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"` // hash of the content, hex encoded
+}
+
+// ReportResult is the result of a single benchmark of a run, a benchmark running
+// with a load profile has a ReportResult per stage in Result.Stages.
+type ReportResult struct {
+	Name  string   `json:"name"`
+	Iter  int      `json:"iter"`            // iterations of the run, not scaled by the ratio of the benchmark, see Result.Iterations
+	Run   int      `json:"run"`             // repetition of the benchmarks, starting at 1
+	Stmts []string `json:"stmts,omitempty"` // names of the statements of a mixed workload, in the order of Result.Mix
+	Result
+}
+
+// NewReportResult returns the report entry of the result of a benchmark.
+func NewReportResult(b Benchmark, iter, run int, result Result) ReportResult {
+	r := ReportResult{Name: b.Name, Iter: iter, Run: run, Result: result}
+	for _, m := range b.Mix {
+		r.Stmts = append(r.Stmts, m.Name)
+	}
+	return r
+}
+
+// ReportSummary describes the metrics of a benchmark over all repeated runs.
+type ReportSummary struct {
+	Name    string             `json:"name"`
+	Iter    int                `json:"iter"`
+	Threads int                `json:"threads"`
+	Metrics map[string]Summary `json:"metrics"` // keyed by the CSV column, e.g. "p99 (μs)"
+}
+
+// Benchmark returns the benchmark of the entry, without its statements.
+func (r ReportResult) Benchmark() Benchmark {
+	b := Benchmark{Name: r.Name}
+	for _, name := range r.Stmts {
+		b.Mix = append(b.Mix, MixStmt{Name: name})
+	}
+	return b
+}
+
+// ReadReport decodes a JSON report, reports of another schema version are rejected.
+func ReadReport(r io.Reader) (Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return Report{}, err
+	}
+	if report.Version != ReportVersion {
+		return Report{}, fmt.Errorf("unsupported report version %v, expected %v", report.Version, ReportVersion)
+	}
+	return report, nil
+}
+
+// WriteReport encodes the report as indented JSON.
+func WriteReport(w io.Writer, report Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,46 @@
+package benchmark
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	result, err := Run(context.Background(), &rowsBencher{}, Benchmark{Name: "rows", Type: TypeLoop, IterRatio: 1.0, Stmt: "2"}, Options{Iter: 50, Threads: 2})
+	require.NoError(t, err)
+	report := Report{
+		Version: ReportVersion,
+		System:  "sqlite",
+		Start:   time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC),
+		Flags:   map[string]string{"iter": "50"},
+		Script:  &ReportScript{Path: "script.sql", SHA256: "00ff"},
+		Results: []ReportResult{NewReportResult(Benchmark{Name: "rows"}, 50, 1, result)},
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteReport(buf, report))
+	// the result is embedded into the entry of the benchmark
+	assert.Contains(t, buf.String(), `"name": "rows",`)
+	assert.Contains(t, buf.String(), `"iter": 50,`)
+	assert.Contains(t, buf.String(), `"totalExecutionCount": 50,`)
+
+	got, err := ReadReport(buf)
+	require.NoError(t, err)
+	assert.Equal(t, report.Flags, got.Flags)
+	assert.Equal(t, report.Script, got.Script)
+	require.Len(t, got.Results, 1)
+	assert.Equal(t, 50, got.Results[0].Iter)
+	assert.Equal(t, 50, got.Results[0].Iterations)
+	assert.Equal(t, uint64(100), got.Results[0].RowCount)
+	assert.Equal(t, result.Percentile(99), got.Results[0].Percentile(99))
+	assert.Equal(t, result.ArithMean(), got.Results[0].ArithMean())
+
+	_, err = ReadReport(strings.NewReader(`{"version": 0}`))
+	assert.EqualError(t, err, "unsupported report version 0, expected 1")
+}
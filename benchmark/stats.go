@@ -0,0 +1,183 @@
+package benchmark
+
+import (
+	"math"
+	"sort"
+)
+
+// Summary describes the values of a metric over the repeated runs of a benchmark.
+type Summary struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stdDev"` // sample standard deviation
+	CILow  float64 `json:"ciLow"`  // lower bound of the 95% confidence interval of the mean
+	CIHigh float64 `json:"ciHigh"` // upper bound of the 95% confidence interval of the mean
+}
+
+// Summarize returns the mean, standard deviation and the 95% confidence interval of
+// the mean of the values, based on the t-distribution. With a single value, the
+// standard deviation is 0 and the interval only contains the value.
+func Summarize(values []float64) Summary {
+	s := Summary{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+	s.CILow, s.CIHigh = s.Mean, s.Mean
+	if s.N == 1 {
+		return s
+	}
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(squares / float64(s.N-1))
+	margin := tQuantile975(s.N-1) * s.StdDev / math.Sqrt(float64(s.N))
+	s.CILow, s.CIHigh = s.Mean-margin, s.Mean+margin
+	return s
+}
+
+// t975 are the 97.5% quantiles of the t-distribution with 1 to 30 degrees of freedom.
+var t975 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tQuantile975 returns the 97.5% quantile of the t-distribution, the factor of the
+// standard error in a two-sided 95% confidence interval. Beyond the table, it is
+// approximated by the Cornish-Fisher expansion around the normal quantile.
+func tQuantile975(df int) float64 {
+	if df <= len(t975) {
+		return t975[df-1]
+	}
+	const z = 1.959964
+	n := float64(df)
+	return z + (z*z*z+z)/(4*n) + (5*math.Pow(z, 5)+16*z*z*z+3*z)/(96*n*n)
+}
+
+// MannWhitney tests whether the values of a and b come from the same distribution,
+// without assuming any distribution (Mann-Whitney U test). It returns the U statistic
+// of a and the two-sided p-value, the probability of a difference at least as large if
+// there were none. The p-value is exact for small samples without ties, otherwise it is
+// approximated by the normal distribution with tie and continuity correction.
+// It is 1 if any of the samples is empty.
+func MannWhitney(a, b []float64) (float64, float64) {
+	n1, n2 := len(a), len(b)
+	if n1 == 0 || n2 == 0 {
+		return 0, 1
+	}
+
+	// rank all values, ties get the mean of their ranks
+	type value struct {
+		v     float64
+		first bool
+	}
+	values := make([]value, 0, n1+n2)
+	for _, v := range a {
+		values = append(values, value{v, true})
+	}
+	for _, v := range b {
+		values = append(values, value{v, false})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].v < values[j].v })
+
+	var rankSum, tieTerm float64
+	ties := false
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].v == values[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // mean of the ranks i+1 to j
+		for k := i; k < j; k++ {
+			if values[k].first {
+				rankSum += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties = true
+			tieTerm += t*t*t - t
+		}
+		i = j
+	}
+	u := rankSum - float64(n1*(n1+1))/2
+
+	if !ties && n1+n2 <= 40 {
+		return u, exactMannWhitney(n1, n2, u)
+	}
+
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * (n + 1 - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		return u, 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return u, math.Min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// MinMannWhitneyP returns the smallest two-sided p-value the Mann-Whitney test can reach
+// with samples of n1 and n2 values without ties, that of completely separated samples.
+// No difference is significant at a level below it, e.g. 0.1 with 3 values each.
+func MinMannWhitneyP(n1, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	// 2 of the C(n1+n2, n1) rank orders are completely separated
+	orders := 1.0
+	for i := 1; i <= n1; i++ {
+		orders = orders * float64(n2+i) / float64(i)
+	}
+	return math.Min(1, 2/orders)
+}
+
+// exactMannWhitney returns the exact two-sided p-value of the U statistic without ties,
+// based on the number of rank orders of n1 and n2 values leading to each U.
+func exactMannWhitney(n1, n2 int, u float64) float64 {
+	// counts[i][j][k] would be the number of orders of i and j values with U = k,
+	// it is computed iteratively over i keeping j as the inner dimension
+	maxU := n1 * n2
+	prev := make([][]float64, n2+1) // counts for i-1
+	for j := range prev {
+		prev[j] = make([]float64, maxU+1)
+		prev[j][0] = 1 // no values of the first sample, U is always 0
+	}
+	for i := 1; i <= n1; i++ {
+		cur := make([][]float64, n2+1)
+		cur[0] = make([]float64, maxU+1)
+		cur[0][0] = 1
+		for j := 1; j <= n2; j++ {
+			cur[j] = make([]float64, maxU+1)
+			for k := 0; k <= i*j; k++ {
+				// the largest value belongs either to the first sample, exceeding all j
+				// values of the second one, or to the second sample
+				if k >= j {
+					cur[j][k] += prev[j][k-j]
+				}
+				cur[j][k] += cur[j-1][k]
+			}
+		}
+		prev = cur
+	}
+
+	counts := prev[n2]
+	var total, lower, upper float64
+	for k, c := range counts {
+		total += c
+		if float64(k) <= u {
+			lower += c
+		}
+		if float64(k) >= u {
+			upper += c
+		}
+	}
+	return math.Min(1, 2*math.Min(lower, upper)/total)
+}
@@ -0,0 +1,59 @@
+package benchmark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	s := Summarize([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	assert.Equal(t, 8, s.N)
+	assert.Equal(t, 5.0, s.Mean)
+	assert.InDelta(t, 2.138, s.StdDev, 0.001)
+	// t(0.975, 7) = 2.365
+	assert.InDelta(t, 5-1.788, s.CILow, 0.001)
+	assert.InDelta(t, 5+1.788, s.CIHigh, 0.001)
+
+	assert.Equal(t, Summary{N: 1, Mean: 3, CILow: 3, CIHigh: 3}, Summarize([]float64{3}))
+	assert.Equal(t, Summary{}, Summarize(nil))
+
+	// the quantiles approach the normal one
+	assert.InDelta(t, 2.021, tQuantile975(40), 0.001)
+	assert.InDelta(t, 1.980, tQuantile975(120), 0.001)
+}
+
+func TestMannWhitney(t *testing.T) {
+	testCases := []struct {
+		description string
+		a, b        []float64
+		u, p        float64
+	}{
+		{"exact/separated", []float64{1, 2, 3, 4}, []float64{5, 6, 7, 8}, 0, 2.0 / 70},
+		{"exact/reversed", []float64{5, 6, 7, 8}, []float64{1, 2, 3, 4}, 16, 2.0 / 70},
+		{"exact/overlapping", []float64{1.1, 2.5, 3.2, 4.8, 5.0, 9.1}, []float64{2.0, 3.3, 6.1, 7.7, 8.4, 9.9}, 11, 0.309524},
+		{"normal/ties", []float64{1, 1, 2, 2, 3, 6}, []float64{3, 4, 4, 5, 5, 7}, 5.5, 0.052555},
+		{"normal/identical", []float64{1, 1, 1}, []float64{1, 1, 1}, 4.5, 1},
+		{"empty", nil, []float64{1}, 0, 1},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			u, p := MannWhitney(tt.a, tt.b)
+			assert.Equal(t, tt.u, u)
+			assert.InDelta(t, tt.p, p, 0.000001)
+		})
+	}
+}
+
+func TestMinMannWhitneyP(t *testing.T) {
+	assert.InDelta(t, 0.1, MinMannWhitneyP(3, 3), 1e-9)
+	assert.InDelta(t, 2.0/70, MinMannWhitneyP(4, 4), 1e-9)
+	assert.InDelta(t, 2.0/252, MinMannWhitneyP(5, 5), 1e-9)
+	assert.Equal(t, 1.0, MinMannWhitneyP(1, 1))
+	assert.Equal(t, 1.0, MinMannWhitneyP(0, 3))
+
+	// it is the p-value of completely separated samples
+	_, p := MannWhitney([]float64{1, 2, 3}, []float64{4, 5, 6})
+	assert.InDelta(t, MinMannWhitneyP(3, 3), p, 1e-9)
+}
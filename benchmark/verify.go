@@ -0,0 +1,100 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+)
+
+// Check is the result set a once benchmark returned on a single system, see Verify.
+type Check struct {
+	Name     string
+	Rows     uint64
+	Checksum string
+	Err      string // first error of the execution, empty if it succeeded
+}
+
+// Verify executes the once benchmarks one after another and returns their result sets.
+// Loop benchmarks are skipped, as their statements usually contain random values.
+// The checksum of every benchmark is computed and the expectations of the script
+// are checked, a benchmark not meeting them returns the error.
+func Verify(ctx context.Context, bencher Bencher, benchmarks []Benchmark) []Check {
+	checks := []Check{}
+	for _, b := range benchmarks {
+		if b.Type != TypeOnce {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		b.Checksum = true
+		result, err := Run(ctx, bencher, b, Options{Iter: 1, Threads: 1})
+		check := Check{Name: b.Name, Rows: result.RowCount, Checksum: result.Checksum}
+		if err != nil {
+			check.Err = err.Error()
+		} else if samples := result.ErrorSamples(); len(samples) > 0 {
+			check.Err = samples[0].Message
+		} else if result.TimeoutCount > 0 {
+			check.Err = "timed out"
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// Comparison compares the result sets of a once benchmark on several systems.
+type Comparison struct {
+	Name   string
+	Checks []Check // result set on each system, in the order passed to Compare
+	Match  bool    // whether it succeeded everywhere with the same rows and checksum
+}
+
+// Compare matches the result sets of several systems by the names of their benchmarks,
+// the n-th benchmark of a name with the n-th one of the same name on the other systems.
+// The comparisons are returned in the order the benchmarks appear first. A benchmark
+// missing on a system fails there.
+func Compare(systems ...[]Check) []Comparison {
+	type key struct {
+		name string
+		n    int
+	}
+	keys, known := []key{}, map[key]bool{}
+	indexed := make([]map[key]Check, len(systems))
+	for i, checks := range systems {
+		indexed[i] = map[key]Check{}
+		seen := map[string]int{}
+		for _, c := range checks {
+			k := key{c.Name, seen[c.Name]}
+			seen[c.Name]++
+			if !known[k] {
+				known[k] = true
+				keys = append(keys, k)
+			}
+			indexed[i][k] = c
+		}
+	}
+
+	comparisons := make([]Comparison, 0, len(keys))
+	for _, k := range keys {
+		cmp := Comparison{Name: k.name, Match: true}
+		for i := range systems {
+			c, ok := indexed[i][k]
+			if !ok {
+				c = Check{Name: k.name, Err: "missing"}
+			}
+			if c.Err != "" || (i > 0 && (c.Rows != cmp.Checks[0].Rows || c.Checksum != cmp.Checks[0].Checksum)) {
+				cmp.Match = false
+			}
+			cmp.Checks = append(cmp.Checks, c)
+		}
+		comparisons = append(comparisons, cmp)
+	}
+	return comparisons
+}
+
+// String describes the result set, e.g. "10 rows, checksum 0123456789abcdef".
+func (c Check) String() string {
+	if c.Err != "" {
+		return "failed: " + c.Err
+	}
+	return fmt.Sprintf("%v rows, checksum %v", c.Rows, c.Checksum)
+}
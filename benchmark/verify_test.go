@@ -0,0 +1,61 @@
+package benchmark
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	checks := Verify(context.Background(), &rowsBencher{}, []Benchmark{
+		{Name: "(once) init", Type: TypeOnce, Stmt: "0"},
+		{Name: "(loop) inserts", Type: TypeLoop, IterRatio: 1.0, Stmt: "1"},
+		{Name: "(once) select", Type: TypeOnce, Stmt: "3"},
+		{Name: "(once) failed", Type: TypeOnce, Stmt: "-1"},
+	})
+
+	require.Len(t, checks, 3)
+	assert.Equal(t, "(once) init", checks[0].Name)
+	assert.Equal(t, uint64(3), checks[1].Rows)
+	assert.Len(t, checks[1].Checksum, 16)
+	assert.Empty(t, checks[1].Err)
+	assert.Equal(t, "failed", checks[2].Err)
+}
+
+func TestCompare(t *testing.T) {
+	postgres := []Check{
+		{Name: "init"},
+		{Name: "select", Rows: 3, Checksum: "aa"},
+		{Name: "count", Rows: 1, Checksum: "bb"},
+		{Name: "clean"},
+	}
+	mysql := []Check{
+		{Name: "init"},
+		{Name: "select", Rows: 3, Checksum: "ab"},
+		{Name: "count", Rows: 1, Checksum: "bb"},
+		{Name: "extra", Err: "failed"},
+	}
+
+	got := Compare(postgres, mysql)
+
+	require.Len(t, got, 5)
+	want := []struct {
+		name  string
+		match bool
+	}{{"init", true}, {"select", false}, {"count", true}, {"clean", false}, {"extra", false}}
+	for i, w := range want {
+		assert.Equal(t, w.name, got[i].Name)
+		assert.Equal(t, w.match, got[i].Match, w.name)
+		assert.Len(t, got[i].Checks, 2)
+	}
+	assert.Equal(t, "missing", got[3].Checks[1].Err)
+	assert.Equal(t, "missing", got[4].Checks[0].Err)
+
+	// benchmarks of the same name are matched by their order
+	got = Compare([]Check{{Name: "a", Rows: 1}, {Name: "a", Rows: 2}}, []Check{{Name: "a", Rows: 1}, {Name: "a", Rows: 2}})
+	require.Len(t, got, 2)
+	assert.True(t, got[0].Match)
+	assert.True(t, got[1].Match)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+)
+
+// higherIsBetter are the metrics which regress when they decrease.
+var higherIsBetter = []string{"ops/s", "success ops/s"}
+
+// eitherWay are the metrics which regress when they change in any direction,
+// as they describe the work done rather than how fast it was done.
+var eitherWay = []string{"executions", "rows", "bytes"}
+
+// delta is the change of a metric of a benchmark between the baseline and the candidate.
+// With repeated runs, the means are compared.
+type delta struct {
+	benchmark string // system, name and iteration count
+	metric    string
+	baseline  float64
+	candidate float64
+	change    float64 // relative change in percent
+	p         float64 // p-value of the Mann-Whitney test, -1 unless both have repeated runs
+	regressed bool
+	// whether there are too few repeated runs for any p-value below alpha,
+	// so the regression only depends on the threshold
+	underpowered bool
+}
+
+// Compare compares the results of the candidate file with those of the baseline file,
+// both written with --writecsv as CSV or JSON, and prints the change of the given metrics.
+// It returns false if any metric of any benchmark got worse by more than threshold percent,
+// or if a benchmark of the baseline is missing in the candidate. If both files contain
+// repeated runs, a change is only a regression if it is significant at the level alpha,
+// unless there are too few runs for that, e.g. 3 each at the level 0.05.
+func Compare(baselineFile, candidateFile string, metrics []string, threshold, alpha float64) bool {
+	baseline, err := readResults(baselineFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read baseline: %v\n", err)
+		return false
+	}
+	candidate, err := readResults(candidateFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read candidate: %v\n", err)
+		return false
+	}
+	for i, metric := range metrics {
+		if metrics[i], err = resolveMetric(hheaders[5:], metric); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return false
+		}
+	}
+
+	deltas, missing, added := compareResults(baseline, candidate, metrics, threshold, alpha)
+
+	ok := len(missing) == 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "benchmark\tmetric\tbaseline\tcandidate\tchange\tp-value\t\n")
+	for _, d := range deltas {
+		status := ""
+		if d.regressed {
+			status = "REGRESSION"
+			ok = false
+		}
+		p := ""
+		if d.p >= 0 {
+			p = fmt.Sprintf("%.3f", d.p)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%+.1f%%\t%v\t%v\n", d.benchmark, d.metric, d.baseline, d.candidate, d.change, p, status)
+	}
+	w.Flush()
+	warned := map[string]bool{}
+	for _, d := range deltas {
+		if d.underpowered && !warned[d.benchmark] {
+			warned[d.benchmark] = true
+			fmt.Fprintf(os.Stderr, "warning: %v has too few runs for a p-value below %v, only the threshold applies\n", d.benchmark, alpha)
+		}
+	}
+	for _, b := range missing {
+		fmt.Printf("%v: missing in the candidate\n", b)
+	}
+	for _, b := range added {
+		fmt.Printf("%v: not in the baseline\n", b)
+	}
+	return ok
+}
+
+// compareResults matches the rows of the baseline and the candidate by system, name and
+// iteration count, see groupRuns. It returns the deltas of the given metrics of all matching
+// rows, as well as the benchmarks only present in the baseline and only in the candidate.
+func compareResults(baseline, candidate []map[string]string, metrics []string, threshold, alpha float64) ([]delta, []string, []string) {
+	candidates := map[string]runGroup{}
+	for _, g := range groupRuns(candidate) {
+		candidates[g.id] = g
+	}
+
+	deltas := []delta{}
+	missing := []string{}
+	matched := map[string]bool{}
+	for _, b := range groupRuns(baseline) {
+		c, ok := candidates[b.id]
+		if !ok {
+			missing = append(missing, b.name)
+			continue
+		}
+		matched[b.id] = true
+		for _, metric := range metrics {
+			base, cand := b.values(metric), c.values(metric)
+			if len(base) == 0 || len(cand) == 0 {
+				continue
+			}
+			d := delta{benchmark: b.name, metric: metric, baseline: benchmark.Summarize(base).Mean, candidate: benchmark.Summarize(cand).Mean, p: -1}
+			d.change, d.regressed = regression(metric, d.baseline, d.candidate, threshold)
+			if len(base) > 1 && len(cand) > 1 {
+				// with repeated runs, only a significant change is a regression,
+				// provided that there are enough of them for any change to be significant
+				_, d.p = benchmark.MannWhitney(base, cand)
+				if benchmark.MinMannWhitneyP(len(base), len(cand)) < alpha {
+					d.regressed = d.regressed && d.p < alpha
+				} else {
+					d.underpowered = true
+				}
+			}
+			deltas = append(deltas, d)
+		}
+	}
+
+	added := []string{}
+	for _, g := range groupRuns(candidate) {
+		if !matched[g.id] {
+			added = append(added, g.name)
+		}
+	}
+	return deltas, missing, added
+}
+
+// regression returns the relative change of a metric in percent and whether it
+// got worse by more than threshold percent. A change from 0 is infinite.
+func regression(metric string, baseline, candidate, threshold float64) (float64, bool) {
+	var change float64
+	switch {
+	case baseline == candidate:
+		return 0, false
+	case baseline == 0:
+		change = math.Inf(1)
+		if candidate < 0 {
+			change = math.Inf(-1)
+		}
+	default:
+		change = (candidate - baseline) / math.Abs(baseline) * 100
+	}
+
+	switch {
+	case contains(higherIsBetter, metric):
+		return change, -change > threshold
+	case contains(eitherWay, metric):
+		return change, math.Abs(change) > threshold
+	default:
+		return change, change > threshold
+	}
+}
+
+// runGroup are the rows of a benchmark in all repeated runs.
+type runGroup struct {
+	id   string // system, name, iteration count and the occurrence of these within a run
+	name string // human-readable name of the benchmark
+	rows []map[string]string
+}
+
+// groupRuns groups the rows of the repeated runs of the same benchmark, identified by
+// system, name and iteration count. If a run contains several rows of a benchmark, e.g. for
+// the stages of a load profile, the n-th one is grouped with the n-th one of the other runs.
+// The groups are returned in the order of their first row.
+func groupRuns(rows []map[string]string) []runGroup {
+	groups := []runGroup{}
+	index := map[string]int{}
+	seen := map[string]int{}
+	for _, r := range rows {
+		name := fmt.Sprintf("%v %v (%vx)", r["system"], r["name"], r["iteration count"])
+		n := seen[name+"#"+r["run"]]
+		seen[name+"#"+r["run"]]++
+		id := fmt.Sprintf("%v#%v", name, n)
+		if i, ok := index[id]; ok {
+			groups[i].rows = append(groups[i].rows, r)
+			continue
+		}
+		if n > 0 {
+			name = fmt.Sprintf("%v #%v", name, n+1)
+		}
+		index[id] = len(groups)
+		groups = append(groups, runGroup{id: id, name: name, rows: []map[string]string{r}})
+	}
+	return groups
+}
+
+// values returns the numeric values of a metric in all runs.
+func (g runGroup) values(metric string) []float64 {
+	values := []float64{}
+	for _, r := range g.rows {
+		if v, err := strconv.ParseFloat(r[metric], 64); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// readResults reads a result file written with --writecsv, either as CSV or JSON report.
+// It returns the rows keyed by the column names of the CSV file.
+func readResults(path string) ([]map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	if filepath.Ext(path) == ".json" || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		report, err := benchmark.ReadReport(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		records = [][]string{hheaders}
+		for _, r := range report.Results {
+			records = append(records, benchmarkRecords(report.System, r.Iter, r.Run, r.Benchmark(), r.Result)...)
+		}
+	} else {
+		if records, err = csv.NewReader(bytes.NewReader(data)).ReadAll(); err != nil {
+			return nil, err
+		}
+		if len(records) == 0 || !reflect.DeepEqual(records[0], hheaders) {
+			return nil, fmt.Errorf("unknown structure of %v, expected the columns %v", path, strings.Join(hheaders, ", "))
+		}
+	}
+
+	return recordMaps(records), nil
+}
+
+// recordMaps returns the rows of a CSV table keyed by the column names of its header.
+func recordMaps(records [][]string) []map[string]string {
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// resolveMetric returns the column of a metric, which may be given without its unit
+// suffix, e.g. "p99" instead of "p99 (μs)".
+func resolveMetric(columns []string, metric string) (string, error) {
+	if contains(columns, metric) {
+		return metric, nil
+	}
+	if contains(columns, metric+" (μs)") {
+		return metric + " (μs)", nil
+	}
+	return "", fmt.Errorf("unknown metric %q, available columns: %v", metric, strings.Join(columns, ", "))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegression(t *testing.T) {
+	testCases := []struct {
+		metric    string
+		baseline  float64
+		candidate float64
+		change    float64
+		regressed bool
+	}{
+		{"arithMean (μs)", 100, 105, 5, false},
+		{"arithMean (μs)", 100, 120, 20, true},
+		{"arithMean (μs)", 100, 50, -50, false},
+		{"ops/s", 100, 120, 20, false},
+		{"ops/s", 100, 80, -20, true},
+		{"rows", 100, 80, -20, true},
+		{"errors", 0, 0, 0, false},
+		{"errors", 0, 1, math.Inf(1), true},
+	}
+
+	for _, tt := range testCases {
+		change, regressed := regression(tt.metric, tt.baseline, tt.candidate, 10)
+		assert.Equal(t, tt.change, change, "%v %v -> %v", tt.metric, tt.baseline, tt.candidate)
+		assert.Equal(t, tt.regressed, regressed, "%v %v -> %v", tt.metric, tt.baseline, tt.candidate)
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	row := func(name, iter, mean string) map[string]string {
+		return map[string]string{"system": "postgres", "name": name, "iteration count": iter, "run": "1", "arithMean (μs)": mean}
+	}
+	baseline := []map[string]string{row("inserts", "100", "100"), row("inserts", "1000", "100"), row("selects", "100", "10"), row("selects", "100", "20")}
+	candidate := []map[string]string{row("selects", "100", "10"), row("selects", "100", "30"), row("inserts", "100", "101"), row("deletes", "100", "5")}
+
+	deltas, missing, added := compareResults(baseline, candidate, []string{"arithMean (μs)"}, 10, 0.05)
+
+	require.Len(t, deltas, 3)
+	assert.Equal(t, delta{benchmark: "postgres inserts (100x)", metric: "arithMean (μs)", baseline: 100, candidate: 101, change: 1, p: -1}, deltas[0])
+	assert.False(t, deltas[1].regressed)
+	// rows of the same benchmark are matched by their order, e.g. the stages of a load profile
+	assert.Equal(t, "postgres selects (100x) #2", deltas[2].benchmark)
+	assert.True(t, deltas[2].regressed)
+	assert.Equal(t, []string{"postgres inserts (1000x)"}, missing)
+	assert.Equal(t, []string{"postgres deletes (100x)"}, added)
+}
+
+func TestCompareRepeated(t *testing.T) {
+	runs := func(means ...int) []map[string]string {
+		rows := []map[string]string{}
+		for i, mean := range means {
+			rows = append(rows, map[string]string{"system": "sqlite", "name": "selects", "iteration count": "100", "run": fmt.Sprint(i + 1), "arithMean (μs)": fmt.Sprint(mean)})
+		}
+		return rows
+	}
+	baseline := runs(100, 101, 102, 103, 104)
+
+	// the means are compared and a significant change is a regression
+	deltas, _, _ := compareResults(baseline, runs(120, 121, 122, 123, 124), []string{"arithMean (μs)"}, 10, 0.05)
+	require.Len(t, deltas, 1)
+	assert.Equal(t, "sqlite selects (100x)", deltas[0].benchmark)
+	assert.Equal(t, 102.0, deltas[0].baseline)
+	assert.Equal(t, 122.0, deltas[0].candidate)
+	assert.InDelta(t, 2.0/252, deltas[0].p, 1e-9)
+	assert.True(t, deltas[0].regressed)
+
+	// a change of the mean caused by a few outliers is not significant
+	deltas, _, _ = compareResults(baseline, runs(95, 100, 105, 140, 150), []string{"arithMean (μs)"}, 10, 0.05)
+	require.Len(t, deltas, 1)
+	assert.Greater(t, deltas[0].change, 10.0)
+	assert.Greater(t, deltas[0].p, 0.05)
+	assert.False(t, deltas[0].regressed)
+
+	// with 3 runs each no change is significant at 0.05, so only the threshold applies
+	deltas, _, _ = compareResults(runs(100, 101, 102), runs(180, 190, 200), []string{"arithMean (μs)"}, 10, 0.05)
+	require.Len(t, deltas, 1)
+	assert.InDelta(t, 0.1, deltas[0].p, 1e-9)
+	assert.True(t, deltas[0].underpowered)
+	assert.True(t, deltas[0].regressed)
+	deltas, _, _ = compareResults(runs(100, 101, 102), runs(101, 102, 103), []string{"arithMean (μs)"}, 10, 0.05)
+	require.Len(t, deltas, 1)
+	assert.False(t, deltas[0].regressed)
+}
+
+func TestSummarizeRuns(t *testing.T) {
+	h := &benchmark.Histogram{}
+	h.Record(2 * time.Millisecond)
+	records := [][]string{hheaders}
+	for run := 1; run <= 3; run++ {
+		result := benchmark.Result{Histogram: h, TotalExecutionCount: uint64(run), Duration: time.Second, Threads: 4}
+		records = append(records, benchmarkRecords("sqlite", 100, run, benchmark.Benchmark{Name: "selects"}, result)...)
+	}
+
+	summaries := summarizeRuns(records)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, "selects", summaries[0].Name)
+	assert.Equal(t, 100, summaries[0].Iter)
+	assert.Equal(t, 4, summaries[0].Threads)
+	assert.Equal(t, benchmark.Summary{N: 3, Mean: 2000, CILow: 2000, CIHigh: 2000}, summaries[0].Metrics["arithMean (μs)"])
+	executions := summaries[0].Metrics["executions"]
+	assert.Equal(t, 2.0, executions.Mean)
+	assert.Equal(t, 1.0, executions.StdDev)
+}
+
+func TestReadResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	h := &benchmark.Histogram{}
+	h.Record(2 * time.Millisecond)
+	result := benchmark.Result{Histogram: h, TotalExecutionCount: 1, Duration: time.Second, Threads: 1, Mix: []benchmark.Result{{Histogram: h}}}
+	b := benchmark.Benchmark{Name: "oltp", Mix: []benchmark.MixStmt{{Name: "select"}}}
+
+	// the rows of a JSON report equal those of the CSV file of the same run
+	jsonFile := filepath.Join(dir, "result.json")
+	f, err := os.Create(jsonFile)
+	require.NoError(t, err)
+	require.NoError(t, benchmark.WriteReport(f, benchmark.Report{Version: benchmark.ReportVersion, System: "mysql", Results: []benchmark.ReportResult{benchmark.NewReportResult(b, 100, 1, result)}}))
+	require.NoError(t, f.Close())
+	fromJSON, err := readResults(jsonFile)
+	require.NoError(t, err)
+
+	csvFile := filepath.Join(dir, "result.csv")
+	records := append([][]string{hheaders}, benchmarkRecords("mysql", 100, 1, b, result)...)
+	lines := []string{}
+	for _, r := range records {
+		lines = append(lines, strings.Join(r, ","))
+	}
+	require.NoError(t, ioutil.WriteFile(csvFile, []byte(strings.Join(lines, "\n")), 0644))
+	fromCSV, err := readResults(csvFile)
+	require.NoError(t, err)
+
+	require.Len(t, fromJSON, 2)
+	assert.Equal(t, fromCSV, fromJSON)
+	assert.Equal(t, "oltp/select", fromJSON[1]["name"])
+	assert.Equal(t, "2000", fromJSON[0]["arithMean (μs)"])
+
+	require.NoError(t, ioutil.WriteFile(csvFile, []byte("a,b\n1,2"), 0644))
+	_, err = readResults(csvFile)
+	assert.Error(t, err)
+}
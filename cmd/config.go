@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes a matrix of benchmark runs, every target is benchmarked with
+// every combination of iteration and thread count, see RunConfig.
+// Relative paths are relative to the directory of the config file.
+type Config struct {
+	Iterations []int             `yaml:"iterations"` // default: 1000
+	Threads    []int             `yaml:"threads"`    // default: 25
+	Host       string            `yaml:"host"`       // default address of the servers
+	Flags      map[string]string `yaml:"flags"`      // further flags of every run, e.g. "sleep: 1s"
+	Targets    []Target          `yaml:"targets"`
+	Results    string            `yaml:"results"` // directory of the result files, default: results
+	Merged     string            `yaml:"merged"`  // file of the merged results, default: <results>/merged_results.csv
+	Charts     ChartConfig       `yaml:"charts"`
+
+	// shell commands run before and after the runs of each iteration count,
+	// e.g. to start fresh docker containers
+	Setup     []string      `yaml:"setup"`
+	SetupWait time.Duration `yaml:"setupWait"` // pause after the setup commands, e.g. until the servers accept connections
+	Teardown  []string      `yaml:"teardown"`
+}
+
+// Target is a system to benchmark.
+type Target struct {
+	System string            `yaml:"system"` // subcommand, e.g. "postgres"
+	Name   string            `yaml:"name"`   // prefix of the result files, default: system
+	Host   string            `yaml:"host"`
+	Port   int               `yaml:"port"`
+	User   string            `yaml:"user"`
+	Pass   string            `yaml:"pass"`
+	Script string            `yaml:"script"` // default: the built-in benchmarks
+	Flags  map[string]string `yaml:"flags"`  // further flags, overriding those of the config
+}
+
+// ChartConfig are the options of the charts created from the merged results.
+type ChartConfig struct {
+	Type    string   `yaml:"type"`    // default: line
+	XAxis   string   `yaml:"xAxis"`   // default: iteration count
+	Metrics []string `yaml:"metrics"` // default: those of createcharts
+}
+
+// connSystems are the subcommands accepting the connection flags.
+var connSystems = []string{"postgres", "mysql", "mssql", "neo4j"}
+
+// LoadConfig reads a config file and fills in the defaults.
+func LoadConfig(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return Config{}, fmt.Errorf("failed to parse %v: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	if len(c.Iterations) == 0 {
+		c.Iterations = []int{1000}
+	}
+	if len(c.Threads) == 0 {
+		c.Threads = []int{25}
+	}
+	if c.Results == "" {
+		c.Results = "results"
+	}
+	c.Results = resolve(c.Results)
+	if c.Merged == "" {
+		c.Merged = filepath.Join(c.Results, "merged_results.csv")
+	}
+	c.Merged = resolve(c.Merged)
+	if c.Charts.Type == "" {
+		c.Charts.Type = "line"
+	}
+	if c.Charts.XAxis == "" {
+		c.Charts.XAxis = "iteration count"
+	}
+	if len(c.Charts.Metrics) == 0 {
+		c.Charts.Metrics = []string{"arithMean (μs)", "geoMean (μs)", "ops/s", "μs/op"}
+	}
+
+	if len(c.Targets) == 0 {
+		return Config{}, fmt.Errorf("no targets in %v", path)
+	}
+	names := map[string]bool{}
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		switch {
+		case contains(connSystems, t.System):
+			if t.Host == "" {
+				t.Host = c.Host
+			}
+		case t.System == "sqlite" || t.System == "sql":
+			if t.Host != "" || t.Port != 0 || t.User != "" || t.Pass != "" {
+				return Config{}, fmt.Errorf("target %v: the %v subcommand has no connection settings", i+1, t.System)
+			}
+		default:
+			return Config{}, fmt.Errorf("target %v: unknown system %q", i+1, t.System)
+		}
+		if t.Name == "" {
+			t.Name = t.System
+		}
+		if names[t.Name] {
+			return Config{}, fmt.Errorf("target %v: duplicate name %q, the result files would overwrite each other", i+1, t.Name)
+		}
+		names[t.Name] = true
+		t.Script = resolve(t.Script)
+	}
+	return c, nil
+}
+
+// ResultFile returns the path of the result file of a target, named like
+// "postgres_1000.csv" or, with several thread counts, "postgres_1000_16threads.csv".
+func (c Config) ResultFile(t Target, iter, threads int) string {
+	name := fmt.Sprintf("%v_%v", t.Name, iter)
+	if len(c.Threads) > 1 {
+		name += fmt.Sprintf("_%vthreads", threads)
+	}
+	return filepath.Join(c.Results, name+".csv")
+}
+
+// Args returns the command line arguments benchmarking a target.
+func (c Config) Args(t Target, iter, threads int) []string {
+	args := []string{t.System, fmt.Sprintf("--iter=%v", iter), fmt.Sprintf("--threads=%v", threads)}
+	if t.Host != "" {
+		args = append(args, "--host="+t.Host)
+	}
+	if t.Port != 0 {
+		args = append(args, fmt.Sprintf("--port=%v", t.Port))
+	}
+	if t.User != "" {
+		args = append(args, "--user="+t.User)
+	}
+	if t.Pass != "" {
+		args = append(args, "--pass="+t.Pass)
+	}
+	if t.Script != "" {
+		args = append(args, "--script="+t.Script)
+	}
+
+	flags := map[string]string{}
+	for name, value := range c.Flags {
+		flags[name] = value
+	}
+	for name, value := range t.Flags {
+		flags[name] = value
+	}
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("--%v=%v", name, flags[name]))
+	}
+	return append(args, "--writecsv="+c.ResultFile(t, iter, threads))
+}
+
+// RunConfig benchmarks every target of the config with all combinations of iteration
+// and thread count, one after another within this process. A failing run, e.g. of an
+// unreachable target, is reported and the remaining ones continue. Afterwards, the
+// results are merged and the charts are created, like with mergecsv and createcharts.
+// It returns false if it was interrupted or a run, setup or teardown command failed.
+func RunConfig(path string) bool {
+	c, err := LoadConfig(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	// every run stops on SIGINT (ctrl-c), this stops the remaining ones
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt)
+	defer signal.Stop(sigchan)
+	interrupted := func() bool {
+		select {
+		case <-sigchan:
+			return true
+		default:
+			return false
+		}
+	}
+
+	start := time.Now()
+	var failed []string
+	succeeded := 0
+	for _, iter := range c.Iterations {
+		fmt.Printf("\nITERATIONS: %v\n", iter)
+		f, n, ok := c.runIteration(iter, interrupted)
+		failed = append(failed, f...)
+		succeeded += n
+		if !ok {
+			printFailed(failed)
+			return false
+		}
+	}
+
+	if succeeded > 0 {
+		fmt.Println("\nMERGE RESULTS")
+		MergeKnownCsv(c.Results, c.Merged)
+		fmt.Println("\nCREATE CHARTS")
+		CreateCharts(c.Merged, c.Charts.Type, c.Charts.XAxis, c.Charts.Metrics)
+	}
+	fmt.Printf("\nTOTAL RUN TIME: %v\n", time.Since(start).Round(time.Second))
+	printFailed(failed)
+	return len(failed) == 0
+}
+
+// runIteration runs the setup commands, benchmarks every target with every thread
+// count and an iteration count, and runs the teardown commands, even if it is
+// interrupted. It returns the failed runs, the number of succeeded ones and false if
+// it was interrupted or a setup or teardown command failed.
+func (c Config) runIteration(iter int, interrupted func() bool) (failed []string, succeeded int, ok bool) {
+	defer func() {
+		if !runCommands(c.Teardown) {
+			ok = false
+		}
+	}()
+	if !runCommands(c.Setup) {
+		return nil, 0, false
+	}
+	time.Sleep(c.SetupWait)
+
+	for _, threads := range c.Threads {
+		for _, t := range c.Targets {
+			fmt.Printf("\nTEST %v (%v threads)\n", t.Name, threads)
+			if err := execute(c.Args(t, iter, threads)); err != nil {
+				fmt.Fprintf(os.Stderr, "failed: %v\n", err)
+				failed = append(failed, fmt.Sprintf("%v (%v iterations, %v threads): %v", t.Name, iter, threads, err))
+			} else {
+				succeeded++
+			}
+			if interrupted() {
+				return failed, succeeded, false
+			}
+		}
+	}
+	return failed, succeeded, true
+}
+
+// printFailed lists the failed runs of RunConfig.
+func printFailed(failed []string) {
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\n%v FAILED RUNS\n", len(failed))
+	for _, f := range failed {
+		fmt.Fprintf(os.Stderr, "\t%v\n", f)
+	}
+}
+
+// runCommands runs shell commands one after another, stopping at the first failing one.
+func runCommands(commands []string) bool {
+	for _, command := range commands {
+		fmt.Printf("$ %v\n", command)
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "command failed: %v\n", err)
+			return false
+		}
+	}
+	return true
+}
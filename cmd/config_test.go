@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RomanBoegli/godbbench/databases"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, dir, config string) string {
+	path := filepath.Join(dir, "bench.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := LoadConfig(writeConfig(t, dir, `
+iterations: [10, 100]
+threads: [1, 8]
+host: db.local
+flags:
+  sleep: 1s
+  conns: 4
+targets:
+  - system: postgres
+    port: 5432
+    pass: secret
+    script: scripts/postgres.sql
+    flags:
+      conns: 16
+  - system: sqlite
+    name: sqlite-wal
+    flags:
+      journal-mode: WAL
+setupWait: 2s
+`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10, 100}, c.Iterations)
+	assert.Equal(t, 2*time.Second, c.SetupWait)
+	assert.Equal(t, filepath.Join(dir, "results"), c.Results)
+	assert.Equal(t, filepath.Join(dir, "results", "merged_results.csv"), c.Merged)
+	assert.Equal(t, "line", c.Charts.Type)
+	assert.Equal(t, "postgres", c.Targets[0].Name)
+
+	assert.Equal(t, []string{
+		"postgres", "--iter=10", "--threads=8", "--host=db.local", "--port=5432", "--pass=secret",
+		"--script=" + filepath.Join(dir, "scripts", "postgres.sql"),
+		"--conns=16", "--sleep=1s",
+		"--writecsv=" + filepath.Join(dir, "results", "postgres_10_8threads.csv"),
+	}, c.Args(c.Targets[0], 10, 8))
+	assert.Equal(t, []string{
+		"sqlite", "--iter=100", "--threads=1", "--conns=4", "--journal-mode=WAL", "--sleep=1s",
+		"--writecsv=" + filepath.Join(dir, "results", "sqlite-wal_100_1threads.csv"),
+	}, c.Args(c.Targets[1], 100, 1))
+
+	invalid := map[string]string{
+		"targets: []":                                    "no targets",
+		"targets: [{system: oracle}]":                    `unknown system "oracle"`,
+		"targets: [{system: sqlite, host: localhost}]":   "no connection settings",
+		"targets: [{system: mysql}, {system: mysql}]":    `duplicate name "mysql"`,
+		"targets: [{system: mysql, port: default}]":      "failed to parse",
+		"targets: [{system: mysql}]\nsetupWait: forever": "failed to parse",
+	}
+	for config, msg := range invalid {
+		_, err := LoadConfig(writeConfig(t, dir, config))
+		if assert.Error(t, err, config) {
+			assert.Contains(t, err.Error(), msg, config)
+		}
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.True(t, RunConfig(writeConfig(t, dir, `
+iterations: [10, 20]
+threads: [2]
+targets:
+  - system: sqlite
+flags:
+  run: inserts
+`)))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "results", "merged_results.csv"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "sqlite,10,inserts,1,2,10,0,"), lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "sqlite,20,inserts,1,2,20,0,"), lines[2])
+	assert.FileExists(t, filepath.Join(dir, "results", "charts.html"))
+}
+
+func TestRunConfigFailingTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the setup fails to empty the table of the built-in benchmarks if it is a view
+	view := filepath.Join(dir, "view.db")
+	s, err := databases.NewSQLite(view, "", "", 1)
+	require.NoError(t, err)
+	require.NoError(t, s.Exec(context.Background(), "CREATE VIEW generic AS SELECT 1 AS generic_id;"))
+	s.Close()
+	// the template refers to an undefined variable
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "undefined.sql"), []byte("\\benchmark loop \\name inserts\nSELECT {{.Vars.undefined}};\n"), 0644))
+
+	tornDown := filepath.Join(dir, "torn-down")
+	require.False(t, RunConfig(writeConfig(t, dir, `
+iterations: [10]
+threads: [2]
+targets:
+  - system: postgres
+    host: 127.0.0.1
+    port: 1
+  - system: sqlite
+    name: sqlite-invalid
+    flags:
+      journal-mode: WAL
+      no-such-flag: 1
+  - system: sqlite
+    name: sqlite-setup
+    flags:
+      file: `+view+`
+  - system: sqlite
+    name: sqlite-template
+    script: undefined.sql
+    flags:
+      run: all
+  - system: sqlite
+flags:
+  run: inserts
+teardown:
+  - touch `+tornDown+`
+`)))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "results", "merged_results.csv"))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[1], "sqlite,10,inserts,1,2,10,0,"), lines[1])
+	assert.FileExists(t, tornDown)
+}
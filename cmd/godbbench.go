@@ -2,22 +2,32 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/RomanBoegli/godbbench/benchmark"
 	"github.com/RomanBoegli/godbbench/databases"
+	"github.com/RomanBoegli/godbbench/statement"
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
@@ -31,22 +41,52 @@ import (
 )
 
 var (
-	hheaders = []string{"system", "iteration count", "name", "executions", "total (μs)", "arithMean (μs)", "geoMean (μs)", "min (μs)", "max (μs)", "ops/s", "μs/op"}
+	// console receives the progress and results printed for humans. It is stderr
+	// when the JSON report is written to stdout, so the latter remains valid JSON.
+	console io.Writer = os.Stdout
+
+	hheaders = []string{"system", "iteration count", "name", "run", "threads", "executions", "errors", "timeouts", "total (μs)", "arithMean (μs)", "geoMean (μs)", "min (μs)", "max (μs)", "p50 (μs)", "p90 (μs)", "p95 (μs)", "p99 (μs)", "p99.9 (μs)", "resp arithMean (μs)", "resp p50 (μs)", "resp p99 (μs)", "resp max (μs)", "ops/s", "success ops/s", "error ops/s", "μs/op", "rows", "bytes"}
 )
 
 func main() {
+	if err := execute(os.Args[1:]); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			os.Exit(0)
+		}
+		log.Fatal(err)
+	}
+}
+
+// execute runs a subcommand, args are the command line arguments without the program
+// name. A benchmark subcommand returns when it is done or failed, e.g. to connect to
+// the database, the others exit.
+func execute(args []string) error {
+	// reset by every benchmark run, see RunConfig
+	console = os.Stdout
+
 	var (
 		// Default set of flags, available for all subcommands (benchmark options).
 		defaultFlags = pflag.NewFlagSet("defaults", pflag.ExitOnError)
 		iter         = defaultFlags.Int("iter", 1000, "how many iterations should be run")
+		duration     = defaultFlags.Duration("duration", 0, "run each loop benchmark for this long instead of --iter iterations (valid units: ns, us, ms, s, m, h)")
 		threads      = defaultFlags.Int("threads", 25, "max. number of green threads (iter >= threads > 0)")
 		sleep        = defaultFlags.Duration("sleep", 0, "how long to pause after each single benchmark (valid units: ns, us, ms, s, m, h)")
+		warmup       = defaultFlags.String("warmup", "0", "iterations (e.g. 100) or duration (e.g. 5s) to execute each loop benchmark before measuring")
+		verbose      = defaultFlags.Bool("verbose", false, "print additional information, e.g. the warm-up metrics")
+		ramp         = defaultFlags.String("ramp", "", "increase the threads of loop benchmarks in stages, one result row per stage, e.g. \"1:64:step=8,hold=20s\"")
+		rate         = defaultFlags.Float64("rate", 0, "start loop executions at this fixed rate (ops/s) instead of back to back, the latency then also includes the delay behind the schedule")
+		prepared     = defaultFlags.Bool("prepared", false, "execute loop benchmarks as prepared statements, binding the {{param}} values instead of rendering them (postgres, mysql, sqlite and neo4j)")
+		repeat       = defaultFlags.Int("repeat", 1, "run all benchmarks this many times and summarize each metric by mean, standard deviation and 95% confidence interval")
+		repeatSetup  = defaultFlags.Bool("repeat-setup", false, "clean up and set up the database again before each repetition (with --repeat)")
+		stmtTimeout  = defaultFlags.Duration("stmt-timeout", 0, "max. duration of a single benchmark execution, 0 means no timeout (valid units: ns, us, ms, s, m, h)")
 		nosetup      = defaultFlags.Bool("nosetup", false, "initialize database and tables, e.g. when running own scripts")
 		nocleanstart = defaultFlags.Bool("nocleanstart", false, "make a cleanup before setup")
 		keep         = defaultFlags.Bool("keep", false, "keep benchmark data")
 		runBench     = defaultFlags.String("run", "all", "only run the specified benchmarks, e.g. \"inserts deletes\"")
 		scriptname   = defaultFlags.String("script", "", "custom sql file to execute")
+		scriptVars   = defaultFlags.StringArray("var", nil, "set a variable of the script, overriding its \\set value, e.g. \"rows=100000\" (repeatable)")
 		writecsv     = defaultFlags.String("writecsv", "", "write result to csv file")
+		output       = defaultFlags.String("output", "csv", "format of the results: csv or json, a versioned report including the run metadata (printed to stdout without --writecsv)")
 
 		// Connection flags, applicable for most databases.
 		connFlags = pflag.NewFlagSet("conn", pflag.ExitOnError)
@@ -60,9 +100,38 @@ func main() {
 		maxconns      = maxconnsFlags.Int("conns", 0, "max. number of open connections")
 
 		// Flag sets for each database. DB specific flags are set in the switch statement below.
-		mysqlFlags    = pflag.NewFlagSet("mysql", pflag.ExitOnError)
-		postgresFlags = pflag.NewFlagSet("postgres", pflag.ExitOnError)
-		neo4jFlags    = pflag.NewFlagSet("neo4j", pflag.ExitOnError)
+		// Their errors are returned, so a run of several benchmarks continues, see RunConfig.
+		mysqlFlags    = pflag.NewFlagSet("mysql", pflag.ContinueOnError)
+		postgresFlags = pflag.NewFlagSet("postgres", pflag.ContinueOnError)
+		neo4jFlags    = pflag.NewFlagSet("neo4j", pflag.ContinueOnError)
+		mssqlFlags    = pflag.NewFlagSet("mssql", pflag.ContinueOnError)
+		sqlFlags      = pflag.NewFlagSet("sql", pflag.ContinueOnError)
+		sqlDriver     = sqlFlags.String("driver", "", "name of the database/sql driver: mysql, postgres, sqlserver or sqlite3")
+		sqlDSN        = sqlFlags.String("dsn", "", "data source name in the format of the driver, e.g. \"postgres://root@localhost:26257/defaultdb?sslmode=disable\"")
+		sqlDialect    = sqlFlags.String("dialect", "standard", "query language of the script: standard, postgres, mysql, sqlite, mssql or cypher")
+		sqlBegin      = sqlFlags.StringSlice("begin", nil, "statements starting a transaction (default: those of the dialect)")
+		sqlCommit     = sqlFlags.StringSlice("commit", nil, "statements committing a transaction (default: those of the dialect)")
+		sqlSeparator  = sqlFlags.String("separator", "", "separator of the single statements (default: that of the dialect)")
+		sqliteFlags   = pflag.NewFlagSet("sqlite", pflag.ContinueOnError)
+		sqliteFile    = sqliteFlags.String("file", databases.SQLiteMemory, "path to the database file, \":memory:\" keeps the database in memory")
+		sqliteJournal = sqliteFlags.String("journal-mode", "", "journal mode pragma: DELETE, TRUNCATE, PERSIST, MEMORY, WAL or OFF (empty -> sqlite default)")
+		sqliteSync    = sqliteFlags.String("synchronous", "", "synchronous pragma: OFF, NORMAL, FULL or EXTRA (empty -> sqlite default)")
+
+		// Flags to verify that the scripts of several systems return the same result sets
+		verifyFlags   = pflag.NewFlagSet("verify", pflag.ExitOnError)
+		verifyTargets = verifyFlags.StringArray("target", nil, "system and script to verify, repeated for each system, e.g. \"system=postgres,script=postgres.sql,user=postgres,pass=password\" (keys: system, name, script, host, port, user, pass, file)")
+
+		// Flags to compare a result file with a baseline
+		compareFlags     = pflag.NewFlagSet("compare", pflag.ExitOnError)
+		compareBaseline  = compareFlags.String("baseline", "", "result file of the baseline, csv or json written with --writecsv")
+		compareCandidate = compareFlags.String("candidate", "", "result file to compare with the baseline")
+		compareThreshold = compareFlags.Float64("threshold", 10, "max. percentage a metric may get worse before it is a regression")
+		compareAlpha     = compareFlags.Float64("alpha", 0.05, "significance level of the Mann-Whitney test between repeated runs, a change is only a regression if its p-value is below")
+		compareMetrics   = compareFlags.StringSlice("metrics", []string{"arithMean", "p99", "ops/s", "errors"}, "comma separated columns to compare, the unit suffix may be omitted")
+
+		// Flags to run the benchmarks described in a config file
+		runFlags  = pflag.NewFlagSet("run", pflag.ExitOnError)
+		runConfig = runFlags.String("config", "bench.yaml", "YAML file describing the targets, the iteration and thread counts and the result locations")
 
 		// Flags to merge result csv files
 		mergeCsvFlags = pflag.NewFlagSet("mergecsv", pflag.ExitOnError)
@@ -73,60 +142,116 @@ func main() {
 		createChartFlags = pflag.NewFlagSet("createcharts", pflag.ExitOnError)
 		dataFile         = createChartFlags.String("dataFile", "../tmp/merged.csv", "path to source data file, assumes headers")
 		chartType        = createChartFlags.String("chartType", "line", "alternative is \"bar\"")
+		chartXAxis       = createChartFlags.String("xAxis", "iteration count", "column of the X-axis, e.g. \"threads\" for results of a --ramp run")
+		chartMetrics     = createChartFlags.StringSlice("metrics", []string{"arithMean (μs)", "geoMean (μs)", "ops/s", "μs/op"}, "comma separated columns to plot, the unit suffix may be omitted, e.g. \"p50,p99,ops/s\"")
 	)
 
 	defaultFlags.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Available subcommands:\n\tmysql | postgres | neo4j | mergecsv | createcharts\n")
+		fmt.Fprintf(os.Stderr, "Available subcommands:\n\tmysql | postgres | mssql | neo4j | sqlite | sql | run | verify | compare | mergecsv | createcharts\n")
 		fmt.Fprintf(os.Stderr, "\tUse 'subcommand --help' for all flags of the specified command.\n")
 	}
 
 	// No comamnd given. Print usage help and exit.
-	if len(os.Args) < 2 {
+	if len(args) < 1 {
 		defaultFlags.Usage()
 		os.Exit(1)
 	}
 
-	var bencher benchmark.Bencher
-	system := os.Args[1]
+	var flags *pflag.FlagSet // flags of the subcommand, part of the JSON report
+	system := args[0]
 
 	switch system {
 	case "postgres":
 		postgresFlags.AddFlagSet(defaultFlags)
 		postgresFlags.AddFlagSet(connFlags)
 		postgresFlags.AddFlagSet(maxconnsFlags)
-		if err := postgresFlags.Parse(os.Args[2:]); err != nil {
-			log.Fatalf("failed to parse postgres flags: %v", err)
+		flags = postgresFlags
+		if err := postgresFlags.Parse(args[1:]); err != nil {
+			return fmt.Errorf("failed to parse postgres flags: %w", err)
 		}
-		bencher = databases.NewPostgres(*host, *port, *user, *pass, *maxconns)
 	case "mysql":
 		mysqlFlags.AddFlagSet(defaultFlags)
 		mysqlFlags.AddFlagSet(connFlags)
 		mysqlFlags.AddFlagSet(maxconnsFlags)
-		if err := mysqlFlags.Parse(os.Args[2:]); err != nil {
-			log.Fatalf("failed to parse mysql flags: %v", err)
+		flags = mysqlFlags
+		if err := mysqlFlags.Parse(args[1:]); err != nil {
+			return fmt.Errorf("failed to parse mysql flags: %w", err)
+		}
+	case "mssql":
+		mssqlFlags.AddFlagSet(defaultFlags)
+		mssqlFlags.AddFlagSet(connFlags)
+		mssqlFlags.AddFlagSet(maxconnsFlags)
+		flags = mssqlFlags
+		if err := mssqlFlags.Parse(args[1:]); err != nil {
+			return fmt.Errorf("failed to parse mssql flags: %w", err)
 		}
-		bencher = databases.NewMySQL(*host, *port, *user, *pass, *maxconns)
 	case "neo4j":
 		neo4jFlags.AddFlagSet(defaultFlags)
 		neo4jFlags.AddFlagSet(connFlags)
-		if err := neo4jFlags.Parse(os.Args[2:]); err != nil {
-			log.Fatalf("failed to parse neo4j flags: %v", err)
+		flags = neo4jFlags
+		if err := neo4jFlags.Parse(args[1:]); err != nil {
+			return fmt.Errorf("failed to parse neo4j flags: %w", err)
+		}
+	case "sqlite":
+		sqliteFlags.AddFlagSet(defaultFlags)
+		sqliteFlags.AddFlagSet(maxconnsFlags)
+		flags = sqliteFlags
+		if err := sqliteFlags.Parse(args[1:]); err != nil {
+			return fmt.Errorf("failed to parse sqlite flags: %w", err)
+		}
+	case "sql":
+		sqlFlags.AddFlagSet(defaultFlags)
+		sqlFlags.AddFlagSet(maxconnsFlags)
+		flags = sqlFlags
+		if err := sqlFlags.Parse(args[1:]); err != nil {
+			return fmt.Errorf("failed to parse sql flags: %w", err)
+		}
+		if *scriptname == "" {
+			return fmt.Errorf("the sql subcommand has no built-in benchmarks, specify a --script")
+		}
+	case "verify":
+		verifyFlags.AddFlagSet(connFlags)
+		if err := verifyFlags.Parse(args[1:]); err != nil {
+			log.Fatalf("failed to parse verify flags: %v", err)
+		}
+		if !Verify(*verifyTargets, *host, *port, *user, *pass) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "compare":
+		if err := compareFlags.Parse(args[1:]); err != nil {
+			log.Fatalf("failed to parse compare flags: %v", err)
+		}
+		if *compareBaseline == "" || *compareCandidate == "" {
+			log.Fatalf("compare needs a --baseline and a --candidate")
+		}
+		// exits with status 1 on a regression, e.g. to fail a CI pipeline
+		if !Compare(*compareBaseline, *compareCandidate, *compareMetrics, *compareThreshold, *compareAlpha) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "run":
+		if err := runFlags.Parse(args[1:]); err != nil {
+			log.Fatalf("failed to parse run flags: %v", err)
+		}
+		if !RunConfig(*runConfig) {
+			os.Exit(1)
 		}
-		bencher = databases.NewNeo4J(*host, *port, *user, *pass)
+		os.Exit(0)
 	case "mergecsv":
-		if err := mergeCsvFlags.Parse(os.Args[2:]); err != nil {
+		if err := mergeCsvFlags.Parse(args[1:]); err != nil {
 			log.Fatalf("failed to parse postgres flags: %v", err)
 		}
 		MergeKnownCsv(*rootDir, *targetFile)
 		os.Exit(0)
 	case "createcharts":
-		if err := createChartFlags.Parse(os.Args[2:]); err != nil {
+		if err := createChartFlags.Parse(args[1:]); err != nil {
 			log.Fatalf("failed to parse postgres flags: %v", err)
 		}
-		CreateCharts(*dataFile, *chartType)
+		CreateCharts(*dataFile, *chartType, *chartXAxis, *chartMetrics)
 		os.Exit(0)
 	default:
-		if err := defaultFlags.Parse(os.Args[1:]); err != nil {
+		if err := defaultFlags.Parse(args); err != nil {
 			log.Fatalf("failed to parse default flags: %v", err)
 		}
 
@@ -135,46 +260,113 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *repeat < 1 {
+		return fmt.Errorf("invalid --repeat %v, at least 1 run is needed", *repeat)
+	}
+	if *output != "csv" && *output != "json" {
+		return fmt.Errorf("unknown --output %q, expected csv or json", *output)
+	}
+	if *output == "json" && *writecsv == "" {
+		console = os.Stderr
+	}
+	warmupOpt, err := benchmark.ParseWarmup(*warmup)
+	if err != nil {
+		return fmt.Errorf("failed to parse --warmup: %v", err)
+	}
+	var rampOpt benchmark.LoadProfile
+	if *ramp != "" {
+		if rampOpt, err = benchmark.ParseLoadProfile(*ramp); err != nil {
+			return fmt.Errorf("failed to parse --ramp: %v", err)
+		}
+	}
+	vars, err := parseVars(*scriptVars)
+	if err != nil {
+		return fmt.Errorf("failed to parse --var: %v", err)
+	}
+
+	// connect to the database
+	var bencher benchmark.Bencher
+	switch system {
+	case "postgres":
+		bencher, err = databases.NewPostgres(*host, *port, *user, *pass, *maxconns)
+	case "mysql":
+		bencher, err = databases.NewMySQL(*host, *port, *user, *pass, *maxconns)
+	case "mssql":
+		bencher, err = databases.NewMSSQL(*host, *port, *user, *pass, *maxconns)
+	case "neo4j":
+		bencher, err = databases.NewNeo4J(*host, *port, *user, *pass)
+	case "sqlite":
+		bencher, err = databases.NewSQLite(*sqliteFile, *sqliteJournal, *sqliteSync, *maxconns)
+	case "sql":
+		base, err := statement.Lookup(*sqlDialect)
+		if err != nil {
+			return err
+		}
+		dialect := *base
+		if sqlFlags.Changed("begin") {
+			dialect.Begin = *sqlBegin
+		}
+		if sqlFlags.Changed("commit") {
+			dialect.Commit = *sqlCommit
+		}
+		if sqlFlags.Changed("separator") {
+			dialect.Separator = *sqlSeparator
+		}
+		if bencher, err = databases.NewGeneric(*sqlDriver, *sqlDSN, &dialect, *maxconns); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, ok := bencher.(benchmark.PreparedBencher); *prepared && !ok {
+		bencher.Close()
+		return fmt.Errorf("the %v subcommand does not support --prepared", system)
+	}
+
+	// cleanup benchmark data when flag is not set, also when failing below,
+	// otherwise only close the connection
+	if *keep {
+		defer bencher.Close()
+	} else {
+		defer bencher.Cleanup(true)
+	}
+
 	// clean old data when cleanstart flag is set
 	if !*nocleanstart {
 		bencher.Cleanup(false)
-		fmt.Println("cleaned data")
+		fmt.Fprintln(console, "cleaned data")
 		// os.Exit(0)
 	}
 
 	// setup database
 	if !*nosetup {
-		bencher.Setup()
-	}
-
-	// cleanup benchmark data when flag is not set
-	if !*keep {
-		defer bencher.Cleanup(true)
+		if err := bencher.Setup(); err != nil {
+			return fmt.Errorf("failed to set up the database: %v", err)
+		}
 	}
 
 	// we need at least one thread
 	if *threads == 0 {
 		*threads = 1
-		fmt.Println("increased to 1 thread")
-	}
-
-	// can't have more threads than iterations
-	if *threads > *iter {
-		*threads = *iter
+		fmt.Fprintln(console, "increased to 1 thread")
 	}
 
 	var benchmarks []benchmark.Benchmark
+	var script []byte
 
 	// If a script was specified, overwrite built-in benchmarks.
 	if *scriptname != "" {
 		dat, err := ioutil.ReadFile(*scriptname)
 		if err != nil {
-			log.Fatalf("failed to read file: %v", err)
+			return fmt.Errorf("failed to read file: %v", err)
 		}
+		script = dat
 		buf := bytes.NewBuffer(dat)
-		benchmarks, err = benchmark.ParseScript(buf)
+		benchmarks, err = benchmark.ParseScriptWith(buf, benchmark.ParseOptions{Dialect: benchmark.DialectOf(bencher), Vars: vars, Path: *scriptname})
 		if err != nil {
-			log.Fatalf("failed to parse script: %v\n", err)
+			return fmt.Errorf("failed to parse script: %v", err)
 		}
 	} else {
 		// Otherwise use built-in benchmarks.
@@ -186,89 +378,501 @@ func main() {
 
 	startTotal := time.Now()
 
-	// notify channel for SIGINT (ctrl-c)
+	// cancel the running benchmark on SIGINT (ctrl-c)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, os.Interrupt)
+	defer signal.Stop(sigchan)
+	go func() {
+		select {
+		case <-sigchan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
+	opts := benchmark.Options{Iter: *iter, Threads: *threads, StmtTimeout: *stmtTimeout, Duration: *duration, Warmup: warmupOpt, Rate: *rate, Ramp: rampOpt, Prepared: *prepared}
 	summary := [][]string{hheaders}
+	var report benchmark.Report
+	if *output == "json" {
+		report = newReport(system, flags, bencher, *scriptname, script)
+	}
 
-	for i, b := range benchmarks {
-		select {
-		case <-sigchan:
-			// got SIGINT, stop benchmarking
-			printTotal(startTotal)
-			// using os.Exit(130) instead of return won't
-			// run deferred funcs (e.g. b.Cleanup())
-			return
-		default:
-			// check if we want to run this particular benchmark
-			if !contains(toRun, "all") && !contains(toRun, b.Name) {
-				continue
+	// consecutive parallel benchmarks are run concurrently as a group
+	groups := benchmark.Group(benchmarks)
+
+	for run := 1; run <= *repeat; run++ {
+		if run > 1 {
+			fmt.Fprintf(console, "repetition %v of %v\n", run, *repeat)
+			if *repeatSetup {
+				bencher.Cleanup(false)
+				if !*nosetup {
+					if err := bencher.Setup(); err != nil {
+						return fmt.Errorf("failed to set up the database: %v", err)
+					}
+				}
 			}
+		}
 
-			// run the particular benchmark
-			results := benchmark.Run(bencher, b, *iter, *threads)
-
-			μsPerOp := float64(results.Duration.Microseconds() / int64(results.TotalExecutionCount))
-			summary = append(summary, []string{
-				system,
-				fmt.Sprint(*iter),
-				b.Name,
-				fmt.Sprint(results.TotalExecutionCount),
-				fmt.Sprint(results.Duration.Microseconds()),
-				fmt.Sprint(results.ArithMean().Microseconds()),
-				fmt.Sprint(results.GeoMean().Microseconds()),
-				fmt.Sprint(results.Min.Microseconds()),
-				fmt.Sprint(results.Max.Microseconds()),
-				fmt.Sprint(int64(float64(results.TotalExecutionCount) / (results.Duration.Seconds()))),
-				fmt.Sprint(int64(μsPerOp))})
-
-			// Don't sleep after the last benchmark
-			if i != len(benchmarks)-1 {
-				time.Sleep(*sleep)
+		for i, group := range groups {
+			select {
+			case <-ctx.Done():
+				// got SIGINT, stop benchmarking
+				printTotal(startTotal)
+				// using os.Exit(130) instead of return won't
+				// run deferred funcs (e.g. b.Cleanup())
+				return nil
+			default:
+				// check if we want to run these particular benchmarks
+				selected := []benchmark.Benchmark{}
+				for _, b := range group {
+					if contains(toRun, "all") || contains(toRun, b.Name) {
+						selected = append(selected, b)
+					}
+				}
+				if len(selected) == 0 {
+					continue
+				}
+
+				// run the particular benchmarks
+				var results []benchmark.Result
+				if len(selected) == 1 {
+					var result benchmark.Result
+					result, err = benchmark.Run(ctx, bencher, selected[0], opts)
+					results = []benchmark.Result{result}
+				} else {
+					results, err = benchmark.RunGroup(ctx, bencher, selected, opts)
+				}
+				if err != nil {
+					return err
+				}
+				if ctx.Err() != nil {
+					// got SIGINT while benchmarking, the result is incomplete
+					continue
+				}
+
+				for j, b := range selected {
+					summary = append(summary, benchmarkRecords(system, *iter, run, b, results[j])...)
+					report.Results = append(report.Results, benchmark.NewReportResult(b, *iter, run, results[j]))
+
+					printErrors(b.Name, results[j])
+					if results[j].Checksum != "" {
+						fmt.Fprintf(console, "%v returned %v rows, checksum %v\n", b.Name, results[j].RowCount, results[j].Checksum)
+					}
+					if *verbose && results[j].Warmup != nil {
+						printWarmup(b.Name, *results[j].Warmup)
+					}
+				}
+
+				// Don't sleep after the last benchmark
+				if i != len(groups)-1 || run != *repeat {
+					time.Sleep(*sleep)
+				}
 			}
 		}
+
+	}
+
+	report.End = time.Now()
+	if *repeat > 1 {
+		report.Summaries = summarizeRuns(summary)
 	}
 
-	// write results to csv
+	// write results to csv or json
 	if *writecsv != "" {
 		path := filepath.Dir(*writecsv)
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			err := os.MkdirAll(path, os.ModePerm)
 			if err != nil {
-				log.Fatalln("failed to create folder", err)
+				return fmt.Errorf("failed to create folder: %v", err)
 			}
 		}
 		f, err := os.Create(*writecsv)
 		if err != nil {
-			log.Fatalln("failed to open file", err)
+			return fmt.Errorf("failed to open file: %v", err)
 		}
 
-		w := csv.NewWriter(f)
-		err = w.WriteAll(summary) // calls Flush internally
-		if err != nil {
-			log.Fatal(err)
+		if *output == "json" {
+			err = benchmark.WriteReport(f, report)
+		} else {
+			w := csv.NewWriter(f)
+			err = w.WriteAll(summary) // calls Flush internally
 		}
 		f.Close()
+		if err != nil {
+			return err
+		}
 		fmt.Printf("Results written to: %v\n", *writecsv)
 
+	} else if *output == "json" {
+		if err := benchmark.WriteReport(os.Stdout, report); err != nil {
+			return err
+		}
 	} else {
 
 		for _, record := range summary[1:] {
-			y := make([]interface{}, len(record)-2)
-			for i, v := range record[2:] {
-				y[i] = v
+			// the run is part of the name, see hheaders
+			name := record[2]
+			if *repeat > 1 {
+				name = fmt.Sprintf("%v (run %v)", record[2], record[3])
+			}
+			y := []interface{}{name}
+			for _, v := range record[4:] {
+				y = append(y, v)
 			}
 
-			fmt.Printf("%v (%vx) took: %vμs\narithMean: %vμs, geoMean: %vμs\nmin: %vμs, max: %vμs\nops/s: %v, μs/op: %v\n\n", y...)
+			fmt.Printf("%v [%v threads] (%vx, %v errors, %v timeouts) took: %vμs\narithMean: %vμs, geoMean: %vμs\nmin: %vμs, max: %vμs\np50: %vμs, p90: %vμs, p95: %vμs, p99: %vμs, p99.9: %vμs\nresponse arithMean: %vμs, p50: %vμs, p99: %vμs, max: %vμs\nops/s: %v (success: %v, error: %v), μs/op: %v\nrows: %v, bytes: %v\n\n", y...)
 		}
 	}
 
+	if *repeat > 1 {
+		printSummaries(report.Summaries)
+	}
+
 	printTotal(startTotal)
+	return nil
+}
+
+// benchmarkRecords returns the summary rows of a benchmark, one row per stage
+// when running with a load profile.
+func benchmarkRecords(system string, iter, run int, b benchmark.Benchmark, results benchmark.Result) [][]string {
+	if len(results.Stages) == 0 {
+		return resultRecords(system, iter, run, b, results)
+	}
+	records := [][]string{}
+	for _, stage := range results.Stages {
+		records = append(records, resultRecords(system, iter, run, b, stage)...)
+	}
+	return records
+}
+
+// resultRecords returns the summary rows of a benchmark result. A mixed workload
+// gets an additional row per statement, named "<benchmark>/<statement>".
+func resultRecords(system string, iter, run int, b benchmark.Benchmark, results benchmark.Result) [][]string {
+	records := [][]string{resultRecord(system, iter, run, b.Name, results)}
+	for k, m := range results.Mix {
+		records = append(records, resultRecord(system, iter, run, b.Name+"/"+b.Mix[k].Name, m))
+	}
+	return records
+}
+
+// resultRecord returns the summary row of a benchmark result, see hheaders.
+func resultRecord(system string, iter, run int, name string, results benchmark.Result) []string {
+	μsPerOp := float64(0)
+	if results.TotalExecutionCount > 0 {
+		μsPerOp = float64(results.Duration.Microseconds() / int64(results.TotalExecutionCount))
+	}
+	record := []string{
+		system,
+		fmt.Sprint(iter),
+		name,
+		fmt.Sprint(run),
+		fmt.Sprint(results.Threads),
+		fmt.Sprint(results.TotalExecutionCount),
+		fmt.Sprint(results.ErrorCount),
+		fmt.Sprint(results.TimeoutCount),
+		fmt.Sprint(results.Duration.Microseconds()),
+		fmt.Sprint(results.ArithMean().Microseconds()),
+		fmt.Sprint(results.GeoMean().Microseconds()),
+		fmt.Sprint(results.Min.Microseconds()),
+		fmt.Sprint(results.Max.Microseconds()),
+	}
+	for _, p := range results.PercentileValues(benchmark.Percentiles...) {
+		record = append(record, fmt.Sprint(p.Microseconds()))
+	}
+	response := results.ResponseHistogram()
+	return append(record,
+		fmt.Sprint(response.Mean().Microseconds()),
+		fmt.Sprint(response.ValueAt(50).Microseconds()),
+		fmt.Sprint(response.ValueAt(99).Microseconds()),
+		fmt.Sprint(response.Max().Microseconds()),
+		fmt.Sprint(int64(results.OpsPerSecond())),
+		fmt.Sprint(int64(results.SuccessOpsPerSecond())),
+		fmt.Sprint(int64(results.ErrorOpsPerSecond())),
+		fmt.Sprint(int64(μsPerOp)),
+		fmt.Sprint(results.RowCount),
+		fmt.Sprint(results.ByteCount))
+}
+
+// summaryMetrics are the metrics printed in the summary of repeated runs.
+var summaryMetrics = []string{"arithMean (μs)", "p99 (μs)", "ops/s"}
+
+// summarizeRuns summarizes every metric of each benchmark over the repeated runs,
+// the rows of the runs are matched like by compare, see groupRuns.
+func summarizeRuns(records [][]string) []benchmark.ReportSummary {
+	summaries := []benchmark.ReportSummary{}
+	for _, g := range groupRuns(recordMaps(records)) {
+		first := g.rows[0]
+		iter, _ := strconv.Atoi(first["iteration count"])
+		threads, _ := strconv.Atoi(first["threads"])
+		s := benchmark.ReportSummary{Name: first["name"], Iter: iter, Threads: threads, Metrics: map[string]benchmark.Summary{}}
+		for _, metric := range hheaders[5:] {
+			s.Metrics[metric] = benchmark.Summarize(g.values(metric))
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries
+}
+
+// printSummaries prints the mean, standard deviation and 95% confidence interval
+// of the summaryMetrics of each benchmark.
+func printSummaries(summaries []benchmark.ReportSummary) {
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "benchmark\tmetric\tmean\tstddev\t95%% CI\t\n")
+	for _, s := range summaries {
+		for _, metric := range summaryMetrics {
+			m := s.Metrics[metric]
+			fmt.Fprintf(w, "%v [%v threads]\t%v\t%.1f\t%.1f\t%.1f .. %.1f\t\n", s.Name, s.Threads, metric, m.Mean, m.StdDev, m.CILow, m.CIHigh)
+		}
+	}
+	w.Flush()
+	fmt.Fprintln(console)
+}
+
+// newReport returns the JSON report of a run without any results yet. Besides the
+// environment, it contains the effective value of every flag, passwords redacted.
+func newReport(system string, flags *pflag.FlagSet, bencher benchmark.Bencher, scriptname string, script []byte) benchmark.Report {
+	report := benchmark.Report{
+		Version:   benchmark.ReportVersion,
+		System:    system,
+		Start:     time.Now(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		GitCommit: gitCommit(),
+		Drivers:   driverVersions(),
+		Flags:     map[string]string{},
+		Results:   []benchmark.ReportResult{},
+	}
+	report.Host, _ = os.Hostname()
+	if v, ok := bencher.(benchmark.VersionBencher); ok {
+		version, err := v.ServerVersion(context.Background())
+		if err != nil {
+			log.Printf("failed to query server version: %v", err)
+		}
+		report.ServerVersion = version
+	}
+	flags.VisitAll(func(f *pflag.Flag) {
+		report.Flags[f.Name] = redact(f.Name, f.Value.String())
+	})
+	if scriptname != "" {
+		sum := sha256.Sum256(script)
+		report.Script = &benchmark.ReportScript{Path: scriptname, SHA256: hex.EncodeToString(sum[:])}
+	}
+	return report
+}
+
+// gitCommit returns the commit checked out in the working directory, if it is a git repository.
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// driverModules are the modules of the database drivers, their versions are part of the JSON report.
+var driverModules = []string{
+	"github.com/denisenkom/go-mssqldb",
+	"github.com/go-sql-driver/mysql",
+	"github.com/lib/pq",
+	"github.com/mattn/go-sqlite3",
+	"github.com/neo4j/neo4j-go-driver/v4",
+}
+
+// driverVersions returns the versions of the driver modules this binary is built with.
+func driverVersions() map[string]string {
+	versions := map[string]string{}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return versions
+	}
+	for _, dep := range info.Deps {
+		if contains(driverModules, dep.Path) {
+			versions[dep.Path] = dep.Version
+		}
+	}
+	return versions
+}
+
+// dsnPasswords match the password of a data source name in URL, MySQL or key=value format.
+var dsnPasswords = []*regexp.Regexp{
+	regexp.MustCompile(`(://[^:/@]*:)[^@]*(@)`),
+	regexp.MustCompile(`^([^:/@=]*:)[^@]*(@)`),
+	regexp.MustCompile(`(?i)((?:password|pwd)\s*=\s*)[^;&\s]*()`),
+}
+
+// redact hides the password of the --pass and --dsn flags.
+func redact(flag, value string) string {
+	switch {
+	case value == "":
+		return value
+	case flag == "pass":
+		return "xxxxx"
+	case flag == "dsn":
+		for _, re := range dsnPasswords {
+			value = re.ReplaceAllString(value, "${1}xxxxx${2}")
+		}
+	}
+	return value
 }
 
 func printTotal(startTotal time.Time) {
-	fmt.Printf("elapsed time: %v\n", time.Since(startTotal))
+	fmt.Fprintf(console, "elapsed time: %v\n", time.Since(startTotal))
+}
+
+// maxPrintedErrors limits the error groups printed per benchmark run, the most frequent ones are printed.
+const maxPrintedErrors = 5
+
+// printErrors reports the grouped errors of a benchmark run, if there were any.
+func printErrors(name string, results benchmark.Result) {
+	if results.FailedCount() == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%v: %v of %v executions failed, %v of them timed out\n", name, results.FailedCount(), results.TotalExecutionCount, results.TimeoutCount)
+	samples := results.ErrorSamples()
+	for i, e := range samples {
+		if i == maxPrintedErrors {
+			var count uint64
+			for _, e := range samples[i:] {
+				count += e.Count
+			}
+			fmt.Fprintf(os.Stderr, "\t%vx in %v further groups\n", count, len(samples)-i)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "\t%vx %v\n\t\te.g. %v\n", e.Count, e.Message, strings.ReplaceAll(e.Stmt, "\n", " "))
+	}
+}
+
+// printWarmup reports the metrics of a benchmark's warm-up phase.
+func printWarmup(name string, warmup benchmark.Result) {
+	fmt.Fprintf(console, "%v warm-up (%vx, %v failed) took: %vμs\narithMean: %vμs, min: %vμs, max: %vμs, p99: %vμs\n\n",
+		name, warmup.TotalExecutionCount, warmup.FailedCount(), warmup.Duration.Microseconds(),
+		warmup.ArithMean().Microseconds(), warmup.Min.Microseconds(), warmup.Max.Microseconds(), warmup.Percentile(99).Microseconds())
+}
+
+// Verify runs the once benchmarks of each target's script and prints whether they
+// return the same rows on all targets. It returns false if any of them doesn't.
+// Host, port, user and password apply to the targets which don't specify their own.
+func Verify(targets []string, host string, port int, user, pass string) bool {
+	if len(targets) < 2 {
+		log.Fatalf("verify needs at least two --target to compare")
+	}
+
+	names := []string{}
+	results := [][]benchmark.Check{}
+	for _, target := range targets {
+		t, err := parseTarget(target)
+		if err != nil {
+			log.Fatalf("failed to parse --target %q: %v", target, err)
+		}
+		if t["script"] == "" {
+			log.Fatalf("--target %q has no script", target)
+		}
+		dat, err := ioutil.ReadFile(t["script"])
+		if err != nil {
+			log.Fatalf("failed to read file: %v", err)
+		}
+
+		targetHost, targetPort := host, port
+		if t["host"] != "" {
+			targetHost = t["host"]
+		}
+		if t["port"] != "" {
+			if targetPort, err = strconv.Atoi(t["port"]); err != nil {
+				log.Fatalf("invalid port of --target %q: %v", target, t["port"])
+			}
+		}
+		targetUser, targetPass := user, pass
+		if t["user"] != "" {
+			targetUser = t["user"]
+		}
+		if t["pass"] != "" {
+			targetPass = t["pass"]
+		}
+
+		var bencher benchmark.Bencher
+		switch t["system"] {
+		case "postgres":
+			bencher, err = databases.NewPostgres(targetHost, targetPort, targetUser, targetPass, 1)
+		case "mysql":
+			bencher, err = databases.NewMySQL(targetHost, targetPort, targetUser, targetPass, 1)
+		case "mssql":
+			bencher, err = databases.NewMSSQL(targetHost, targetPort, targetUser, targetPass, 1)
+		case "neo4j":
+			bencher, err = databases.NewNeo4J(targetHost, targetPort, targetUser, targetPass)
+		case "sqlite":
+			file := t["file"]
+			if file == "" {
+				file = databases.SQLiteMemory
+			}
+			bencher, err = databases.NewSQLite(file, "", "", 1)
+		default:
+			log.Fatalf("unknown system of --target %q, expected postgres, mysql, mssql, neo4j or sqlite", target)
+		}
+		if err != nil {
+			log.Fatalf("failed to connect to --target %q: %v", target, err)
+		}
+
+		// the same script may contain the statements of all systems in \dialect sections
+		benchmarks, err := benchmark.ParseScriptWith(bytes.NewBuffer(dat), benchmark.ParseOptions{Dialect: benchmark.DialectOf(bencher), Path: t["script"]})
+		if err != nil {
+			log.Fatalf("failed to parse script %v: %v\n", t["script"], err)
+		}
+
+		fmt.Printf("verifying %v\n", t["script"])
+		results = append(results, benchmark.Verify(context.Background(), bencher, benchmarks))
+		// verify neither sets up nor removes any data, that's up to the script
+		bencher.Close()
+		if t["name"] == "" {
+			t["name"] = t["system"]
+		}
+		names = append(names, t["name"])
+	}
+
+	ok := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, cmp := range benchmark.Compare(results...) {
+		status := "ok"
+		if !cmp.Match {
+			status = "MISMATCH"
+			ok = false
+		}
+		fmt.Fprintf(w, "%v\t%v\n", cmp.Name, status)
+		for i, c := range cmp.Checks {
+			fmt.Fprintf(w, "  %v\t%v\n", names[i], c)
+		}
+	}
+	w.Flush()
+	return ok
+}
+
+// parseVars parses the variables given as "name=value".
+func parseVars(values []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not a name=value pair", v)
+		}
+		vars[v[:i]] = v[i+1:]
+	}
+	return vars, nil
+}
+
+// parseTarget parses the comma separated key=value pairs of a --target.
+func parseTarget(s string) (map[string]string, error) {
+	known := []string{"system", "name", "script", "host", "port", "user", "pass", "file"}
+	t := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !contains(known, kv[0]) {
+			return nil, fmt.Errorf("invalid option %q, expected one of %v followed by =<value>", pair, strings.Join(known, ", "))
+		}
+		t[kv[0]] = kv[1]
+	}
+	return t, nil
 }
 
 func contains(options []string, want string) bool {
@@ -326,7 +930,7 @@ func MergeKnownCsv(rootDir string, targetFile string) {
 	fmt.Printf("Result:  \t%v\n", targetFile)
 }
 
-func CreateCharts(dataFile string, charttype string) {
+func CreateCharts(dataFile string, charttype string, xAxis string, metrics []string) {
 
 	csvfile, err := os.Open(dataFile)
 	if err != nil {
@@ -340,19 +944,31 @@ func CreateCharts(dataFile string, charttype string) {
 	}
 
 	systems := unique(df.Select([]string{"system"}).Records())
-	mults, _ := castToIntArray(unique(df.Select([]string{"iteration count"}).Records()))
+	if !contains(df.Names(), xAxis) {
+		log.Fatalf("unknown X-axis column %q", xAxis)
+	}
+	df = df.Arrange(dataframe.Sort(xAxis))
+	mults, _ := castToIntArray(unique(df.Select([]string{xAxis}).Records()))
 	names := unique(df.Select([]string{"name"}).Records())
 
+	// resolve metrics given without unit suffix, e.g. "p99" instead of "p99 (μs)"
+	columns := df.Names()
+	for i, metric := range metrics {
+		if metrics[i], err = resolveMetric(columns[3:], metric); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	page := components.NewPage()
 
 	for c1, name := range names {
-		for c2, metric := range []string{"arithMean (μs)", "geoMean (μs)", "ops/s", "μs/op"} {
-			chart := getBasicChart(fmt.Sprintf("Chart %v.%v: %v", c1+1, c2, name), "", "iteration count", metric)
+		for c2, metric := range metrics {
+			chart := getBasicChart(fmt.Sprintf("Chart %v.%v: %v", c1+1, c2, name), "", xAxis, metric)
 			chart.SetXAxis(mults)
 			for _, system := range systems {
 				data := df.
-					Filter(dataframe.F{0, "system", "==", system}).
-					Filter(dataframe.F{1, "name", "==", name}).
+					Filter(dataframe.F{Colidx: 0, Colname: "system", Comparator: "==", Comparando: system}).
+					Filter(dataframe.F{Colidx: 1, Colname: "name", Comparator: "==", Comparando: name}).
 					Select([]string{metric}).Records()
 				if len(data) != 0 {
 					chart.AddSeries(system, generateBarItems(data))
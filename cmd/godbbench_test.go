@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/databases"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteIterationCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "script.sql")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`
+\benchmark loop \name global
+SELECT {{.Iter}};
+\benchmark loop \iter 20 \name own
+SELECT {{.Iter}};
+`), 0644))
+	csvFile := filepath.Join(dir, "results.csv")
+	require.NoError(t, execute([]string{"sqlite", "--iter=4", "--threads=8", "--script=" + script, "--writecsv=" + csvFile}))
+
+	// the iteration count is the global one, the threads are capped by the iterations of each benchmark
+	data, err := ioutil.ReadFile(csvFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], "sqlite,4,(loop) global,1,4,4,0,"), lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "sqlite,4,(loop) own,1,8,20,0,"), lines[2])
+
+	// the JSON report holds the iterations of each benchmark as well
+	jsonFile := filepath.Join(dir, "results.json")
+	require.NoError(t, execute([]string{"sqlite", "--iter=4", "--threads=8", "--script=" + script, "--writecsv=" + jsonFile, "--output=json"}))
+	f, err := os.Open(jsonFile)
+	require.NoError(t, err)
+	defer f.Close()
+	report, err := benchmark.ReadReport(f)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, []int{4, 4}, []int{report.Results[0].Iter, report.Results[1].Iter})
+	assert.Equal(t, []int{4, 20}, []int{report.Results[0].Iterations, report.Results[1].Iterations})
+}
+
+func TestVerifyKeepsData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the databases contain the table of the built-in benchmarks, which verify must not drop
+	script := filepath.Join(dir, "script.sql")
+	require.NoError(t, ioutil.WriteFile(script, []byte("\\benchmark once \\name count\nSELECT COUNT(*) FROM generic;\n"), 0644))
+	targets := []string{}
+	for _, name := range []string{"a", "b"} {
+		file := filepath.Join(dir, name+".db")
+		s, err := databases.NewSQLite(file, "", "", 1)
+		require.NoError(t, err)
+		require.NoError(t, s.Setup())
+		s.Close()
+		targets = append(targets, "system=sqlite,name="+name+",file="+file+",script="+script)
+	}
+
+	assert.True(t, Verify(targets, "", 0, "", ""))
+	assert.True(t, Verify(targets, "", 0, "", ""), "the table was dropped by the first verify")
+}
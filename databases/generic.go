@@ -0,0 +1,89 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/statement"
+)
+
+// Generic implements the bencher interface for any registered database/sql driver.
+// It has no built-in benchmarks, the database is set up by the benchmark script.
+type Generic struct {
+	db      *sql.DB
+	driver  string
+	dialect *statement.Dialect // splits the statements and detects the transactions
+}
+
+// NewGeneric returns a new bencher using the given database/sql driver and data source name.
+// The statements are split and their transactions detected according to the given dialect.
+func NewGeneric(driver, dataSourceName string, dialect *statement.Dialect, maxOpenConns int) (*Generic, error) {
+	drivers := sql.Drivers()
+	sort.Strings(drivers)
+	if i := sort.SearchStrings(drivers, driver); i == len(drivers) || drivers[i] != driver {
+		return nil, fmt.Errorf("unknown driver %q, available drivers: %v", driver, strings.Join(drivers, ", "))
+	}
+	if dialect.Separator == "" {
+		return nil, fmt.Errorf("the statement separator must not be empty")
+	}
+
+	db, err := sql.Open(driver, dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping db: %v", err)
+	}
+
+	db.SetMaxOpenConns(maxOpenConns)
+
+	g := &Generic{db: db, driver: driver, dialect: dialect}
+	return g, nil
+}
+
+// Benchmarks returns no benchmarks, a script is required.
+func (g *Generic) Benchmarks() []benchmark.Benchmark {
+	return []benchmark.Benchmark{}
+}
+
+// Setup does nothing, the script has to initialize the database.
+func (g *Generic) Setup() error { return nil }
+
+// Cleanup closes the connection, the script has to remove its data.
+func (g *Generic) Cleanup(closeConnection bool) {
+	if closeConnection {
+		g.Close()
+	}
+}
+
+// Close closes the connection, the benchmarking data is kept.
+func (g *Generic) Close() {
+	if err := g.db.Close(); err != nil {
+		log.Printf("failed to close connection: %v", err)
+	}
+}
+
+// Exec executes the given statement on the database.
+// It stops at the first failing statement and returns its error.
+func (g *Generic) Exec(ctx context.Context, stmt string) error {
+	return g.dialect.Run(ctx, sqlSession{db: g.db}, stmt)
+}
+
+// ServerVersion returns the version of the database server, if the driver is known.
+func (g *Generic) ServerVersion(ctx context.Context) (string, error) {
+	if _, ok := versionQueries[g.driver]; !ok {
+		return "", fmt.Errorf("unknown version query of driver %v", g.driver)
+	}
+	return queryVersion(ctx, g.db, g.driver)
+}
+
+// Dialect returns the name of the query language, it selects the \dialect sections of scripts.
+func (g *Generic) Dialect() string {
+	return g.dialect.Name
+}
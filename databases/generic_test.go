@@ -0,0 +1,59 @@
+package databases
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/statement"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericScript(t *testing.T) {
+	// the in-memory database lives as long as its single connection
+	dialect := *statement.Standard
+	dialect.Begin = []string{"start  transaction"}
+	dialect.Commit = []string{"end"}
+	dialect.Separator = "|"
+	g, err := NewGeneric("sqlite3", ":memory:", &dialect, 1)
+	require.NoError(t, err)
+	defer g.Cleanup(true)
+
+	benchmarks, err := benchmark.ParseScript(strings.NewReader(`
+		\benchmark once \name setup
+		CREATE TABLE account (id INT PRIMARY KEY, balance INT) |
+
+		\benchmark loop \name transfer
+		START TRANSACTION |
+		INSERT INTO account (id, balance) VALUES ({{.Iter}}, 100) |
+		UPDATE account SET balance = balance - 10 WHERE id = {{.Iter}} |
+		END |
+		`))
+	require.NoError(t, err)
+
+	for _, b := range benchmarks {
+		result, err := benchmark.Run(context.Background(), g, b, benchmark.Options{Iter: 20, Threads: 2})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), result.FailedCount(), "%v: %v", b.Name, result.ErrorSamples())
+	}
+
+	var n int
+	require.NoError(t, g.db.QueryRow("SELECT COUNT(*) FROM account WHERE balance = 90").Scan(&n))
+	assert.Equal(t, 20, n)
+}
+
+func TestGenericTransactionRollback(t *testing.T) {
+	g, err := NewGeneric("sqlite3", ":memory:", statement.SQLite, 1)
+	require.NoError(t, err)
+	defer g.Cleanup(true)
+	require.NoError(t, g.Exec(context.Background(), "CREATE TABLE t (id INT PRIMARY KEY); INSERT INTO t VALUES (1);"))
+
+	err = g.Exec(context.Background(), "BEGIN; INSERT INTO t VALUES (2); INSERT INTO t VALUES (1); COMMIT;")
+	assert.Error(t, err)
+
+	var n int
+	require.NoError(t, g.db.QueryRow("SELECT COUNT(*) FROM t").Scan(&n))
+	assert.Equal(t, 1, n)
+}
@@ -0,0 +1,86 @@
+package databases
+
+import (
+	"testing"
+
+	"github.com/RomanBoegli/godbbench/statement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMSSQLBatches(t *testing.T) {
+	testCases := []struct {
+		description string
+		in          string
+		want        []mssqlBatch
+	}{
+		{
+			description: "no separator",
+			in:          "SELECT 1;\nSELECT 2;",
+			want:        []mssqlBatch{{stmt: "SELECT 1;\nSELECT 2;", count: 1}},
+		},
+		{
+			description: "separated batches",
+			in:          "DROP SCHEMA IF EXISTS s;\nGO\nCREATE SCHEMA s;\ngo\nCREATE TABLE s.t (id INT);",
+			want: []mssqlBatch{
+				{stmt: "DROP SCHEMA IF EXISTS s;", count: 1},
+				{stmt: "CREATE SCHEMA s;", count: 1},
+				{stmt: "CREATE TABLE s.t (id INT);", count: 1},
+			},
+		},
+		{
+			description: "count",
+			in:          "INSERT INTO t DEFAULT VALUES;\nGO 5",
+			want:        []mssqlBatch{{stmt: "INSERT INTO t DEFAULT VALUES;", count: 5}},
+		},
+		{
+			description: "go within a line",
+			in:          "SELECT 'GO';\nSELECT 1 AS go",
+			want:        []mssqlBatch{{stmt: "SELECT 'GO';\nSELECT 1 AS go", count: 1}},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitMSSQLBatches(tt.in))
+		})
+	}
+}
+
+func TestMSSQLBatchStmts(t *testing.T) {
+	testCases := []struct {
+		description string
+		in          string
+		want        []statement.Statement
+	}{
+		{
+			description: "whole batch",
+			in:          "DECLARE @x INT; SET @x = 1;\nSELECT @x;",
+			want:        []statement.Statement{{Text: "DECLARE @x INT; SET @x = 1;\nSELECT @x;", Query: true}},
+		},
+		{
+			description: "transaction control statements",
+			in:          "BEGIN TRAN; DECLARE @x INT; SET @x = 1; INSERT INTO t VALUES (@x); COMMIT TRAN",
+			want: []statement.Statement{
+				{Text: "BEGIN TRAN", Kind: statement.Begin},
+				{Text: "DECLARE @x INT;\nSET @x = 1;\nINSERT INTO t VALUES (@x)"},
+				{Text: "COMMIT TRAN", Kind: statement.Commit},
+			},
+		},
+		{
+			description: "transaction within a block",
+			in:          "IF 1 = 1 BEGIN BEGIN TRAN; INSERT INTO t VALUES (1); COMMIT; END",
+			want:        []statement.Statement{{Text: "IF 1 = 1 BEGIN BEGIN TRAN; INSERT INTO t VALUES (1); COMMIT; END"}},
+		},
+		{
+			description: "comments only",
+			in:          "-- nothing to do",
+			want:        []statement.Statement{},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			assert.Equal(t, tt.want, mssqlBatchStmts(tt.in))
+		})
+	}
+}
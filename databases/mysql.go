@@ -1,21 +1,23 @@
 package databases
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"strings"
 
 	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/statement"
 )
 
 // Mysql implements the bencher interface.
 type Mysql struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts stmtCache // prepared statements, see ExecPrepared
 }
 
-// NewMySQL returns a new mysql bencher.
-func NewMySQL(host string, port int, user, password string, maxOpenConns int) *Mysql {
+// NewMySQL returns a new mysql bencher connected to the server.
+func NewMySQL(host string, port int, user, password string, maxOpenConns int) (*Mysql, error) {
 	if port == 0 {
 		port = 3306
 	}
@@ -24,110 +26,87 @@ func NewMySQL(host string, port int, user, password string, maxOpenConns int) *M
 
 	db, err := sql.Open("mysql", dataSourceName)
 	if err != nil {
-		log.Fatalf("failed to open connection: %v\n", err)
+		return nil, fmt.Errorf("failed to open connection: %v", err)
 	}
 	if err := db.Ping(); err != nil {
-		log.Fatalf("failed to ping db: %v", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to ping db: %v", err)
 	}
 
 	db.SetMaxOpenConns(maxOpenConns)
 	p := &Mysql{db: db}
-	return p
+	return p, nil
 }
 
 // Benchmarks returns the individual benchmark functions for the mysql db.
 func (m *Mysql) Benchmarks() []benchmark.Benchmark {
 	return []benchmark.Benchmark{
-		{Name: "inserts", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "INSERT INTO godbbench.Generic (GenericId, Name, Balance, Description) VALUES( {{.Iter}}, '{{call .RandString 3 10 }}', {{call .RandFloat64}}, '{{call .RandString 0 100 }}' );"},
-		{Name: "selects", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "SELECT * FROM godbbench.Generic WHERE GenericId = {{.Iter}};"},
-		{Name: "updates", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "UPDATE godbbench.Generic SET Name = '{{call .RandString 3 10 }}', Balance = {{call .RandFloat64}} WHERE GenericId = {{.Iter}};"},
-		{Name: "deletes", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "DELETE FROM godbbench.Generic WHERE GenericId = {{.Iter}};"},
+		{Name: "inserts", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "INSERT INTO godbbench.Generic (GenericId, Name, Balance, Description) VALUES( {{param .Iter}}, {{param (call .RandString 3 10)}}, {{param (call .RandFloat64)}}, {{param (call .RandString 0 100)}} );"},
+		{Name: "selects", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "SELECT * FROM godbbench.Generic WHERE GenericId = {{param .Iter}};"},
+		{Name: "updates", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "UPDATE godbbench.Generic SET Name = {{param (call .RandString 3 10)}}, Balance = {{param (call .RandFloat64)}} WHERE GenericId = {{param .Iter}};"},
+		{Name: "deletes", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "DELETE FROM godbbench.Generic WHERE GenericId = {{param .Iter}};"},
 	}
 }
 
 // Setup initializes the database for the benchmark.
-func (m *Mysql) Setup() {
+func (m *Mysql) Setup() error {
 	if _, err := m.db.Exec("CREATE DATABASE IF NOT EXISTS godbbench;"); err != nil {
-		log.Fatalf("failed to create database: %v\n", err)
+		return fmt.Errorf("failed to create database: %v", err)
 	}
 	if _, err := m.db.Exec("USE godbbench;"); err != nil {
-		log.Fatalf("failed to USE godbbench: %v\n", err)
+		return fmt.Errorf("failed to USE godbbench: %v", err)
 	}
 	if _, err := m.db.Exec("CREATE TABLE IF NOT EXISTS godbbench.Generic (GenericId INT PRIMARY KEY, Name VARCHAR(10), Balance DECIMAL, Description VARCHAR(100));"); err != nil {
-		log.Fatalf("failed to create table: %v\n", err)
+		return fmt.Errorf("failed to create table: %v", err)
 	}
 	if _, err := m.db.Exec("TRUNCATE godbbench.Generic;"); err != nil {
-		log.Fatalf("failed to truncate table: %v\n", err)
+		return fmt.Errorf("failed to truncate table: %v", err)
 	}
+	return nil
 }
 
 // Cleanup removes all remaining benchmarking data.
 func (m *Mysql) Cleanup(closeConnection bool) {
+	m.stmts.close()
 	if _, err := m.db.Exec("DROP DATABASE IF EXISTS godbbench;"); err != nil {
 		log.Printf("failed drop schema: %v\n", err)
 	}
 	if closeConnection {
-		if err := m.db.Close(); err != nil {
-			log.Printf("failed to close connection: %v", err)
-		}
+		m.Close()
 	}
 }
 
-// Exec executes the given statement on the database.
-func (m *Mysql) Exec(stmt string) {
-
-	isInTransaciton := false
-	singleStmts := strings.Split(stmt, ";")
-	execTrans := []string{}
-	for _, stmt := range singleStmts {
-
-		stmt = strings.TrimSpace(stmt)
-
-		if stmt == "START TRANSACTION" {
-			isInTransaciton = true
-			continue
-		}
-		if stmt == "COMMIT" {
-			isInTransaciton = false
-			m.ExecTransaction(execTrans)
-			execTrans = []string{}
-			continue
-		}
-
-		if isInTransaciton {
-			execTrans = append(execTrans, stmt)
-		} else {
-			m.ExecStatement(stmt)
-		}
+// Close closes the connection, the benchmarking data is kept.
+func (m *Mysql) Close() {
+	m.stmts.close()
+	if err := m.db.Close(); err != nil {
+		log.Printf("failed to close connection: %v", err)
 	}
 }
 
 // Exec executes the given statement on the database.
-func (m *Mysql) ExecStatement(stmt string) {
+// It stops at the first failing statement and returns its error.
+func (m *Mysql) Exec(ctx context.Context, stmt string) error {
+	return statement.MySQL.Run(ctx, sqlSession{db: m.db}, stmt)
+}
 
-	if stmt != "" {
-		_, err := m.db.Exec(stmt)
-		if err != nil {
-			log.Printf("%v failed: %v", stmt, err)
-		}
-	}
+// Placeholder returns the placeholder of the n-th parameter of a prepared statement.
+func (m *Mysql) Placeholder(n int) string {
+	return statement.MySQL.Placeholder(n)
+}
 
+// ExecPrepared executes the given statement with its parameters bound to args.
+// Each statement is prepared once per connection.
+func (m *Mysql) ExecPrepared(ctx context.Context, stmt string, args []interface{}) error {
+	return execPrepared(ctx, statement.MySQL, m.db, &m.stmts, stmt, args)
 }
 
-// Exec executes the given statement on the database using transactions.
-func (m *Mysql) ExecTransaction(singleStmts []string) {
-	transaction, err := m.db.Begin()
-	if err != nil {
-		panic(err)
-	}
-	for _, stmt := range singleStmts {
-		if stmt != "" {
-			if a, err := transaction.Exec(stmt); err != nil {
-				log.Fatalf("%v: failed(!): %v\n%v\n", stmt, err, a)
-			}
-		}
-	}
-	if err = transaction.Commit(); err != nil {
-		log.Fatalf("%v: failed(!): %v\n", transaction, err)
-	}
+// ServerVersion returns the version of the database server.
+func (m *Mysql) ServerVersion(ctx context.Context) (string, error) {
+	return queryVersion(ctx, m.db, "mysql")
+}
+
+// Dialect returns the name of the query language, it selects the \dialect sections of scripts.
+func (m *Mysql) Dialect() string {
+	return statement.MySQL.Name
 }
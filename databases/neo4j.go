@@ -1,11 +1,16 @@
 package databases
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/statement"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
 )
 
@@ -14,8 +19,8 @@ type Neo4j struct {
 	driver neo4j.Driver
 }
 
-// NewNeo4J returns a new neo4j bencher.
-func NewNeo4J(host string, port int, user, password string) *Neo4j {
+// NewNeo4J returns a new neo4j bencher connected to the server.
+func NewNeo4J(host string, port int, user, password string) (*Neo4j, error) {
 
 	if port == 0 {
 		port = 7687
@@ -24,35 +29,36 @@ func NewNeo4J(host string, port int, user, password string) *Neo4j {
 	uri := fmt.Sprintf("neo4j://%v:%v", host, port)
 	driver, err := neo4j.NewDriver(uri, neo4j.BasicAuth(user, password, ""))
 	if err != nil {
-		return nil
+		return nil, fmt.Errorf("failed to create driver: %v", err)
 	}
-
-	if err != nil {
-		log.Fatalf("failed to create session: %v\n", err)
+	if err := driver.VerifyConnectivity(); err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("failed to ping db: %v", err)
 	}
 
 	p := &Neo4j{driver: driver}
-	return p
+	return p, nil
 }
 
 // Benchmarks returns the individual benchmark functions for the cassandra db.
 // TODO: update is not like other db statements balance = balance + balance!
 func (c *Neo4j) Benchmarks() []benchmark.Benchmark {
 	return []benchmark.Benchmark{
-		{Name: "inserts", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "CREATE (ee:Person {id: {{.Iter}}, from: 'Switzerland', balance: {{call .RandInt64}}});"},
-		{Name: "selects", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "MATCH (ee:Person) WHERE ee.id = {{.Iter}} RETURN ee;"},
-		{Name: "updates", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "MATCH (ee:Person {id: {{.Iter}} }) SET ee.balance = {{call .RandInt64}};"},
-		{Name: "deletes", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "MATCH (n:Person {id: {{.Iter}} }) DELETE n"},
+		{Name: "inserts", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "CREATE (ee:Person {id: {{param .Iter}}, from: 'Switzerland', balance: {{param (call .RandInt64)}}});"},
+		{Name: "selects", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "MATCH (ee:Person) WHERE ee.id = {{param .Iter}} RETURN ee;"},
+		{Name: "updates", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "MATCH (ee:Person {id: {{param .Iter}} }) SET ee.balance = {{param (call .RandInt64)}};"},
+		{Name: "deletes", Type: benchmark.TypeLoop, IterRatio: 1.0, Parallel: false, Stmt: "MATCH (n:Person {id: {{param .Iter}} }) DELETE n"},
 	}
 }
 
 // Setup initializes the database for the benchmark.
-func (c *Neo4j) Setup() {
+func (c *Neo4j) Setup() error {
 	session := c.driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
 	_, err := session.Run("MATCH (n) DETACH DELETE n", nil)
 	if err != nil {
-		log.Fatalf("failed to create keyspace: %v\n", err)
+		return fmt.Errorf("failed to create keyspace: %v", err)
 	}
+	return nil
 }
 
 // Cleanup removes all remaining benchmarking data.
@@ -62,67 +68,271 @@ func (c *Neo4j) Cleanup(closeConnection bool) {
 		log.Printf("failed to drop table: %v\n", err)
 	}
 
+	session.Close()
+
 	if closeConnection {
-		session.Close()
-		c.driver.Close()
+		c.Close()
 	}
 }
 
-// Exec executes the given statement on the database.
-func (n *Neo4j) Exec(stmt string) {
+// Close closes the connection, the benchmarking data is kept.
+func (c *Neo4j) Close() {
+	c.driver.Close()
+}
 
-	isInTransaciton := false
-	singleStmts := strings.Split(stmt, ";")
-	execTrans := []string{}
-	for _, stmt := range singleStmts {
+// Exec executes the given statement on the database.
+// It stops at the first failing statement and returns its error.
+func (n *Neo4j) Exec(ctx context.Context, stmt string) error {
+	return statement.Cypher.Run(ctx, neo4jSession{driver: n.driver}, stmt)
+}
 
-		stmt = strings.TrimSpace(stmt)
+// Placeholder returns the placeholder of the n-th parameter of a prepared statement.
+func (n *Neo4j) Placeholder(i int) string {
+	return statement.Cypher.Placeholder(i)
+}
 
-		if stmt == ":begin" {
-			isInTransaciton = true
-			continue
-		}
-		if stmt == ":commit" {
-			isInTransaciton = false
-			n.ExecTransaction(execTrans)
-			execTrans = []string{}
-			continue
-		}
+// ExecPrepared executes the given statement with its parameters bound to args,
+// which are passed to the server as parameter map. The server caches the plan of
+// each statement, so there is nothing to prepare.
+func (n *Neo4j) ExecPrepared(ctx context.Context, stmt string, args []interface{}) error {
+	return statement.Cypher.RunArgs(ctx, neo4jSession{driver: n.driver}, stmt, args)
+}
 
-		if isInTransaciton {
-			execTrans = append(execTrans, stmt)
-		} else {
-			n.ExecStatement(stmt)
-		}
+// ServerVersion returns the name, version and edition of the database server.
+func (n *Neo4j) ServerVersion(ctx context.Context) (string, error) {
+	session := n.driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close()
+	timeout, err := txTimeout(ctx)
+	if err != nil {
+		return "", err
+	}
+	result, err := session.Run("CALL dbms.components() YIELD name, versions, edition RETURN name + ' ' + versions[0] + ' ' + edition", nil, timeout)
+	if err != nil {
+		return "", err
+	}
+	record, err := result.Single()
+	if err != nil {
+		return "", err
 	}
+	return fmt.Sprint(record.Values[0]), nil
+}
+
+// Dialect returns the name of the query language, it selects the \dialect sections of scripts.
+func (n *Neo4j) Dialect() string {
+	return statement.Cypher.Name
+}
+
+// neo4jSession executes the statements of the neo4j bencher,
+// every statement and transaction uses its own session.
+type neo4jSession struct {
+	driver neo4j.Driver
 }
 
 // Exec executes the given statement on the database.
-func (n *Neo4j) ExecStatement(stmt string) {
-	session := n.driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+func (s neo4jSession) Exec(ctx context.Context, stmt string, args ...interface{}) error {
+	timeout, err := txTimeout(ctx)
+	if err != nil {
+		return err
+	}
+	session := s.driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
 	defer session.Close()
-	if stmt != "" {
-		if _, err := session.Run(stmt, nil); err != nil {
-			log.Fatalf("%v: failed(!): %v\n", stmt, err)
-		}
+	result, err := session.Run(stmt, neo4jParams(args), timeout)
+	if err != nil {
+		return err
 	}
+	return consumeRecords(ctx, result)
 }
 
-// Exec executes the given statement on the database using transactions.
-func (n *Neo4j) ExecTransaction(singleStmts []string) {
-	session := n.driver.NewSession(neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
-	defer session.Close()
-	transaction, err := session.BeginTransaction()
+// Query executes the given statement on the database, like Exec all its records are read.
+func (s neo4jSession) Query(ctx context.Context, stmt string, args ...interface{}) error {
+	return s.Exec(ctx, stmt, args...)
+}
+
+// Begin starts a transaction in a new session, which only reads if the options say so.
+func (s neo4jSession) Begin(ctx context.Context, opts *sql.TxOptions) (statement.Tx, error) {
+	timeout, err := txTimeout(ctx)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	mode := neo4j.AccessModeWrite
+	if opts != nil && opts.ReadOnly {
+		mode = neo4j.AccessModeRead
 	}
-	defer transaction.Close()
-	for _, stmt := range singleStmts {
-		if stmt != "" {
-			if _, err := transaction.Run(stmt, nil); err != nil {
-				log.Fatalf("%v: failed(!): %v\n", stmt, err)
+	session := s.driver.NewSession(neo4j.SessionConfig{AccessMode: mode})
+	tx, err := session.BeginTransaction(timeout)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return &neo4jTx{session: session, tx: tx}, nil
+}
+
+// neo4jTx is a transaction of a neo4jSession, it closes the session when it ends.
+type neo4jTx struct {
+	session neo4j.Session
+	tx      neo4j.Transaction
+}
+
+// Exec executes the given statement within the transaction. The timeout of the
+// transaction was set when it began, the driver can't stop a single statement.
+func (t *neo4jTx) Exec(ctx context.Context, stmt string, args ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	result, err := t.tx.Run(stmt, neo4jParams(args))
+	if err != nil {
+		return err
+	}
+	return consumeRecords(ctx, result)
+}
+
+// Query executes the given statement within the transaction, like Exec all its records are read.
+func (t *neo4jTx) Query(ctx context.Context, stmt string, args ...interface{}) error {
+	return t.Exec(ctx, stmt, args...)
+}
+
+// Commit commits the transaction.
+func (t *neo4jTx) Commit() error {
+	defer t.close()
+	return t.tx.Commit()
+}
+
+// Rollback rolls the transaction back.
+func (t *neo4jTx) Rollback() error {
+	defer t.close()
+	return t.tx.Rollback()
+}
+
+func (t *neo4jTx) close() {
+	t.tx.Close()
+	t.session.Close()
+}
+
+// consumeRecords reads all records of the result, as the driver fetches them lazily,
+// and records their number and estimated size with the benchmark, as well as their
+// values if it computes their checksum.
+func consumeRecords(ctx context.Context, result neo4j.Result) error {
+	var count, size int64
+	checksum := benchmark.Checksumming(ctx)
+	for result.Next() {
+		count++
+		values := result.Record().Values
+		for _, v := range values {
+			size += neo4jValueSize(v)
+		}
+		if checksum {
+			row := make([]string, len(values))
+			for i, v := range values {
+				row[i] = neo4jValueString(v)
 			}
+			benchmark.ChecksumRow(ctx, row...)
+		}
+	}
+	// errors of the statement are reported with the result summary
+	if _, err := result.Consume(); err != nil {
+		return err
+	}
+	benchmark.RecordRows(ctx, count, size)
+	return nil
+}
+
+// neo4jValueSize estimates the size of a value in bytes: strings and byte arrays
+// count their length, numbers 8 bytes, graph entities the size of their properties.
+func neo4jValueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case []interface{}:
+		var size int64
+		for _, e := range v {
+			size += neo4jValueSize(e)
+		}
+		return size
+	case map[string]interface{}:
+		var size int64
+		for k, e := range v {
+			size += int64(len(k)) + neo4jValueSize(e)
+		}
+		return size
+	case neo4j.Node:
+		size := 8 + neo4jValueSize(v.Props)
+		for _, l := range v.Labels {
+			size += int64(len(l))
+		}
+		return size
+	case neo4j.Relationship:
+		return 24 + int64(len(v.Type)) + neo4jValueSize(v.Props)
+	case neo4j.Path:
+		var size int64
+		for _, n := range v.Nodes {
+			size += neo4jValueSize(n)
+		}
+		for _, r := range v.Relationships {
+			size += neo4jValueSize(r)
 		}
+		return size
+	default:
+		return 8
+	}
+}
+
+// neo4jValueString returns the text representation of a value for its checksum, numbers
+// are formatted without exponent like the SQL databases return them, NULL as empty string.
+func neo4jValueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// neo4jParams maps the arguments to the parameters $p1, $p2 and so on.
+func neo4jParams(args []interface{}) map[string]interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	params := make(map[string]interface{}, len(args))
+	for i, arg := range args {
+		params[strings.TrimPrefix(statement.Cypher.Placeholder(i+1), "$")] = arg
+	}
+	return params
+}
+
+// txTimeout derives the server side transaction timeout from the context deadline,
+// as the v4 driver does not accept a context. It returns the error of the context if
+// it is done already, as a timeout of zero would mean none at all.
+func txTimeout(ctx context.Context) (func(*neo4j.TransactionConfig), error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return func(*neo4j.TransactionConfig) {}, nil
+	}
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	if timeout < time.Millisecond {
+		// the server truncates the timeout to milliseconds
+		timeout = time.Millisecond
 	}
-	transaction.Commit()
+	return func(config *neo4j.TransactionConfig) {
+		config.Timeout = timeout
+	}, nil
 }
@@ -0,0 +1,51 @@
+package databases
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxTimeout(t *testing.T) {
+	t.Run("no deadline", func(t *testing.T) {
+		// act
+		timeout, err := txTimeout(context.Background())
+
+		// assert
+		require.NoError(t, err)
+		config := neo4j.TransactionConfig{}
+		timeout(&config)
+		assert.Zero(t, config.Timeout)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		// arrange
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		// act
+		timeout, err := txTimeout(ctx)
+
+		// assert
+		require.NoError(t, err)
+		config := neo4j.TransactionConfig{}
+		timeout(&config)
+		assert.True(t, config.Timeout > 0 && config.Timeout <= time.Minute)
+	})
+
+	t.Run("deadline passed", func(t *testing.T) {
+		// arrange
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		// act
+		_, err := txTimeout(ctx)
+
+		// assert
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
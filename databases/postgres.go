@@ -1,21 +1,23 @@
 package databases
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"strings"
 
 	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/statement"
 )
 
 // Postgres implements the bencher interface.
 type Postgres struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts stmtCache // prepared statements, see ExecPrepared
 }
 
-// NewPostgres returns a new postgres bencher.
-func NewPostgres(host string, port int, user, password string, maxOpenConns int) *Postgres {
+// NewPostgres returns a new postgres bencher connected to the server.
+func NewPostgres(host string, port int, user, password string, maxOpenConns int) (*Postgres, error) {
 	if port == 0 {
 		port = 5432
 	}
@@ -24,43 +26,46 @@ func NewPostgres(host string, port int, user, password string, maxOpenConns int)
 
 	db, err := sql.Open("postgres", dataSourceName)
 	if err != nil {
-		log.Fatalf("failed to open connection: %v\n", err)
+		return nil, fmt.Errorf("failed to open connection: %v", err)
 	}
 	if err := db.Ping(); err != nil {
-		log.Fatalf("failed to ping db: %v", err)
+		db.Close()
+		return nil, fmt.Errorf("failed to ping db: %v", err)
 	}
 
 	db.SetMaxOpenConns(maxOpenConns)
 
 	p := &Postgres{db: db}
-	return p
+	return p, nil
 }
 
 // Benchmarks returns the individual benchmark statements for the postgres db.
 func (p *Postgres) Benchmarks() []benchmark.Benchmark {
 	return []benchmark.Benchmark{
-		{Name: "inserts", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "INSERT INTO godbbench.generic (generic_id, name, balance, description) VALUES( {{.Iter}}, '{{call .RandString 3 10 }}', {{call .RandInt64}}, '{{call .RandString 0 100 }}' );"},
-		{Name: "selects", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "SELECT * FROM godbbench.generic WHERE generic_id = {{.Iter}};"},
-		{Name: "updates", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "UPDATE godbbench.generic SET name = '{{call .RandString 3 10 }}', balance = {{call .RandInt64}} WHERE generic_id = {{.Iter}};"},
-		{Name: "deletes", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "DELETE FROM godbbench.generic WHERE generic_id = {{.Iter}};"},
+		{Name: "inserts", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "INSERT INTO godbbench.generic (generic_id, name, balance, description) VALUES( {{param .Iter}}, {{param (call .RandString 3 10)}}, {{param (call .RandInt64)}}, {{param (call .RandString 0 100)}} );"},
+		{Name: "selects", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "SELECT * FROM godbbench.generic WHERE generic_id = {{param .Iter}};"},
+		{Name: "updates", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "UPDATE godbbench.generic SET name = {{param (call .RandString 3 10)}}, balance = {{param (call .RandInt64)}} WHERE generic_id = {{param .Iter}};"},
+		{Name: "deletes", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "DELETE FROM godbbench.generic WHERE generic_id = {{param .Iter}};"},
 	}
 }
 
 // Setup initializes the database for the benchmark.
-func (p *Postgres) Setup() {
+func (p *Postgres) Setup() error {
 	if _, err := p.db.Exec("CREATE SCHEMA IF NOT EXISTS godbbench"); err != nil {
-		log.Fatalf("failed to create schema: %v\n", err)
+		return fmt.Errorf("failed to create schema: %v", err)
 	}
 	if _, err := p.db.Exec("CREATE TABLE IF NOT EXISTS godbbench.generic (generic_id INT PRIMARY KEY, name VARCHAR(10), balance DECIMAL, description VARCHAR(100));"); err != nil {
-		log.Fatalf("failed to create table: %v\n", err)
+		return fmt.Errorf("failed to create table: %v", err)
 	}
 	if _, err := p.db.Exec("TRUNCATE godbbench.generic;"); err != nil {
-		log.Fatalf("failed to truncate table: %v\n", err)
+		return fmt.Errorf("failed to truncate table: %v", err)
 	}
+	return nil
 }
 
 // Cleanup removes all remaining benchmarking data.
 func (p *Postgres) Cleanup(closeConnection bool) {
+	p.stmts.close()
 	if _, err := p.db.Exec("DROP TABLE IF EXISTS godbbench.generic CASCADE;"); err != nil {
 		log.Printf("failed to drop table: %v\n", err)
 	}
@@ -68,65 +73,41 @@ func (p *Postgres) Cleanup(closeConnection bool) {
 		log.Printf("failed drop schema: %v\n", err)
 	}
 	if closeConnection {
-		if err := p.db.Close(); err != nil {
-			log.Printf("failed to close connection: %v", err)
-		}
+		p.Close()
 	}
 }
 
-// Exec executes the given statement on the database.
-func (p *Postgres) Exec(stmt string) {
-
-	isInTransaciton := false
-	singleStmts := strings.Split(stmt, ";")
-	execTrans := []string{}
-	for _, stmt := range singleStmts {
-
-		stmt = strings.TrimSpace(stmt)
-
-		if stmt == "BEGIN" {
-			isInTransaciton = true
-			continue
-		}
-		if stmt == "COMMIT" {
-			isInTransaciton = false
-			p.ExecTransaction(execTrans)
-			execTrans = []string{}
-			continue
-		}
-
-		if isInTransaciton {
-			execTrans = append(execTrans, stmt)
-		} else {
-			p.ExecStatement(stmt)
-		}
+// Close closes the connection, the benchmarking data is kept.
+func (p *Postgres) Close() {
+	p.stmts.close()
+	if err := p.db.Close(); err != nil {
+		log.Printf("failed to close connection: %v", err)
 	}
 }
 
 // Exec executes the given statement on the database.
-func (p *Postgres) ExecStatement(stmt string) {
-	if stmt != "" {
-		_, err := p.db.Exec(stmt)
-		if err != nil {
-			log.Printf("%v failed: %v", stmt, err)
-		}
-	}
+// It stops at the first failing statement and returns its error.
+func (p *Postgres) Exec(ctx context.Context, stmt string) error {
+	return statement.Postgres.Run(ctx, sqlSession{db: p.db}, stmt)
 }
 
-// Exec executes the given statement on the database using transactions.
-func (p *Postgres) ExecTransaction(singleStmts []string) {
-	transaction, err := p.db.Begin()
-	if err != nil {
-		panic(err)
-	}
-	for _, stmt := range singleStmts {
-		if stmt != "" {
-			if _, err := transaction.Exec(stmt); err != nil {
-				log.Fatalf("%v: failed(!): %v\n", stmt, err)
-			}
-		}
-	}
-	if err = transaction.Commit(); err != nil {
-		log.Fatalf("%v: failed(!): %v\n", transaction, err)
-	}
+// Placeholder returns the placeholder of the n-th parameter of a prepared statement.
+func (p *Postgres) Placeholder(n int) string {
+	return statement.Postgres.Placeholder(n)
+}
+
+// ExecPrepared executes the given statement with its parameters bound to args.
+// Each statement is prepared once per connection.
+func (p *Postgres) ExecPrepared(ctx context.Context, stmt string, args []interface{}) error {
+	return execPrepared(ctx, statement.Postgres, p.db, &p.stmts, stmt, args)
+}
+
+// ServerVersion returns the version of the database server.
+func (p *Postgres) ServerVersion(ctx context.Context) (string, error) {
+	return queryVersion(ctx, p.db, "postgres")
+}
+
+// Dialect returns the name of the query language, it selects the \dialect sections of scripts.
+func (p *Postgres) Dialect() string {
+	return statement.Postgres.Name
 }
@@ -0,0 +1,255 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/statement"
+)
+
+// sqlSession executes the statements of the database/sql based benchers.
+type sqlSession struct {
+	db    sqlDB
+	stmts *stmtCache // prepares the statements if set, otherwise they are executed directly
+}
+
+// sqlDB is either a database, i.e. a pool of connections, or a single connection of it.
+type sqlDB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Exec executes the given statement on the database.
+func (s sqlSession) Exec(ctx context.Context, stmt string, args ...interface{}) error {
+	if s.stmts != nil {
+		prepared, err := s.stmts.get(ctx, s.db, stmt)
+		if err != nil {
+			return err
+		}
+		if prepared != nil {
+			_, err = prepared.ExecContext(ctx, args...)
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// Query executes the given statement on the database and reads all returned rows.
+func (s sqlSession) Query(ctx context.Context, stmt string, args ...interface{}) error {
+	if s.stmts != nil {
+		prepared, err := s.stmts.get(ctx, s.db, stmt)
+		if err != nil {
+			return err
+		}
+		if prepared != nil {
+			rows, err := prepared.QueryContext(ctx, args...)
+			return consumeRows(ctx, rows, err)
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	return consumeRows(ctx, rows, err)
+}
+
+// Begin starts a transaction with the given options, nil for the defaults.
+func (s sqlSession) Begin(ctx context.Context, opts *sql.TxOptions) (statement.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{tx: tx, stmts: s.stmts}, nil
+}
+
+// sqlTx is a transaction of a sqlSession.
+type sqlTx struct {
+	tx    *sql.Tx
+	stmts *stmtCache
+}
+
+// Exec executes the given statement within the transaction.
+func (t sqlTx) Exec(ctx context.Context, stmt string, args ...interface{}) error {
+	// preparing it now could wait for another connection, see execPrepared
+	if prepared := t.stmts.lookup(stmt); prepared != nil {
+		// reuses the statement if it is already prepared on the connection of the transaction
+		_, err := t.tx.StmtContext(ctx, prepared).ExecContext(ctx, args...)
+		return err
+	}
+	_, err := t.tx.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+// Query executes the given statement within the transaction and reads all returned rows.
+func (t sqlTx) Query(ctx context.Context, stmt string, args ...interface{}) error {
+	if prepared := t.stmts.lookup(stmt); prepared != nil {
+		rows, err := t.tx.StmtContext(ctx, prepared).QueryContext(ctx, args...)
+		return consumeRows(ctx, rows, err)
+	}
+	rows, err := t.tx.QueryContext(ctx, stmt, args...)
+	return consumeRows(ctx, rows, err)
+}
+
+// Commit commits the transaction.
+func (t sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback rolls the transaction back.
+func (t sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// consumeRows reads all rows of all result sets, so the time to transfer and decode
+// them is part of the execution, and records their number and size with the benchmark,
+// as well as their values if it computes their checksum.
+// The size is the length of the values as received by the driver, e.g. their text
+// representation, not including any protocol overhead.
+func consumeRows(ctx context.Context, rows *sql.Rows, err error) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var count, size int64
+	checksum := benchmark.Checksumming(ctx)
+	for {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		values := make([]sql.RawBytes, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				return err
+			}
+			count++
+			for _, v := range values {
+				size += int64(len(v))
+			}
+			if checksum {
+				row := make([]string, len(values))
+				for i, v := range values {
+					row[i] = string(v)
+				}
+				benchmark.ChecksumRow(ctx, row...)
+			}
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	benchmark.RecordRows(ctx, count, size)
+	return nil
+}
+
+// versionQueries are the queries returning the server version, by database/sql driver name.
+var versionQueries = map[string]string{
+	"mysql":     "SELECT VERSION()",
+	"postgres":  "SELECT version()",
+	"sqlite3":   "SELECT sqlite_version()",
+	"sqlserver": "SELECT @@VERSION",
+}
+
+// queryVersion returns the server version queried with the version query of the driver.
+// Line breaks and repeated spaces of the version are collapsed.
+func queryVersion(ctx context.Context, db *sql.DB, driver string) (string, error) {
+	var version string
+	if err := db.QueryRowContext(ctx, versionQueries[driver]).Scan(&version); err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(version), " "), nil
+}
+
+// maxPreparedStmts limits the number of statements kept prepared, e.g. if the
+// statements of a benchmark contain random values instead of bound parameters.
+const maxPreparedStmts = 1000
+
+// stmtCache keeps the prepared statements of a bencher. database/sql prepares
+// each of them once per connection, the first time it's used on that connection.
+type stmtCache struct {
+	mux   sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// execPrepared executes the script with its parameters bound to args as prepared statements.
+// The statements are prepared before any transaction begins, as the transaction holds its
+// connection, so preparing a statement within it could wait forever for a free connection.
+func execPrepared(ctx context.Context, d *statement.Dialect, db *sql.DB, c *stmtCache, script string, args []interface{}) error {
+	stmts, err := d.Bind(script, args)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if stmt.Kind == statement.Plain {
+			if _, err := c.get(ctx, db, stmt.Text); err != nil {
+				return err
+			}
+		}
+	}
+	return d.Exec(ctx, sqlSession{db: db, stmts: c}, stmts)
+}
+
+// lookup returns the prepared statement, nil if it is not prepared.
+func (c *stmtCache) lookup(query string) *sql.Stmt {
+	if c == nil {
+		return nil
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.stmts[query]
+}
+
+// get returns the prepared statement, preparing it if necessary.
+// It returns nil if the cache is full and the statement is not prepared yet.
+func (c *stmtCache) get(ctx context.Context, db sqlDB, query string) (*sql.Stmt, error) {
+	c.mux.Lock()
+	stmt, ok := c.stmts[query]
+	full := len(c.stmts) >= maxPreparedStmts
+	c.mux.Unlock()
+	if ok {
+		return stmt, nil
+	}
+	if full {
+		return nil, nil
+	}
+
+	// prepare without holding the lock, as it requires a round trip to the server
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if other, ok := c.stmts[query]; ok {
+		// prepared concurrently by another goroutine
+		stmt.Close()
+		return other, nil
+	}
+	if c.stmts == nil {
+		c.stmts = map[string]*sql.Stmt{}
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// close closes all prepared statements, e.g. before the tables they refer to are dropped.
+func (c *stmtCache) close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, stmt := range c.stmts {
+		stmt.Close()
+	}
+	c.stmts = nil
+}
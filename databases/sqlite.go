@@ -0,0 +1,124 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+	"github.com/RomanBoegli/godbbench/statement"
+)
+
+// SQLiteMemory is the file name of an in-memory SQLite database.
+const SQLiteMemory = ":memory:"
+
+// SQLite implements the bencher interface.
+type SQLite struct {
+	db    *sql.DB
+	stmts stmtCache // prepared statements, see ExecPrepared
+}
+
+// NewSQLite returns a new sqlite bencher. The database is stored in the given file,
+// or kept in memory if file is ":memory:". The journal mode and synchronous flag are
+// set on every connection, empty values keep the SQLite defaults.
+func NewSQLite(file, journalMode, synchronous string, maxOpenConns int) (*SQLite, error) {
+	params := url.Values{}
+	// wait for locks of concurrent writers instead of failing immediately
+	params.Set("_busy_timeout", "5000")
+	if journalMode != "" {
+		params.Set("_journal_mode", journalMode)
+	}
+	if synchronous != "" {
+		params.Set("_synchronous", synchronous)
+	}
+
+	dataSourceName := fmt.Sprintf("file:%v?%v", file, params.Encode())
+
+	db, err := sql.Open("sqlite3", dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping db: %v", err)
+	}
+
+	if file == SQLiteMemory {
+		// every connection would get its own empty in-memory database
+		maxOpenConns = 1
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+
+	s := &SQLite{db: db}
+	return s, nil
+}
+
+// Benchmarks returns the individual benchmark statements for the sqlite db.
+func (s *SQLite) Benchmarks() []benchmark.Benchmark {
+	return []benchmark.Benchmark{
+		{Name: "inserts", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "INSERT INTO generic (generic_id, name, balance, description) VALUES( {{param .Iter}}, {{param (call .RandString 3 10)}}, {{param (call .RandInt64)}}, {{param (call .RandString 0 100)}} );"},
+		{Name: "selects", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "SELECT * FROM generic WHERE generic_id = {{param .Iter}};"},
+		{Name: "updates", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "UPDATE generic SET name = {{param (call .RandString 3 10)}}, balance = {{param (call .RandInt64)}} WHERE generic_id = {{param .Iter}};"},
+		{Name: "deletes", Type: benchmark.TypeLoop, IterRatio: 1.0, Stmt: "DELETE FROM generic WHERE generic_id = {{param .Iter}};"},
+	}
+}
+
+// Setup initializes the database for the benchmark.
+func (s *SQLite) Setup() error {
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS generic (generic_id INT PRIMARY KEY, name VARCHAR(10), balance DECIMAL, description VARCHAR(100));"); err != nil {
+		return fmt.Errorf("failed to create table: %v", err)
+	}
+	// SQLite has no TRUNCATE, an unqualified DELETE is optimized to the same
+	if _, err := s.db.Exec("DELETE FROM generic;"); err != nil {
+		return fmt.Errorf("failed to truncate table: %v", err)
+	}
+	return nil
+}
+
+// Cleanup removes all remaining benchmarking data.
+func (s *SQLite) Cleanup(closeConnection bool) {
+	s.stmts.close()
+	if _, err := s.db.Exec("DROP TABLE IF EXISTS generic;"); err != nil {
+		log.Printf("failed to drop table: %v\n", err)
+	}
+	if closeConnection {
+		s.Close()
+	}
+}
+
+// Close closes the connection, the benchmarking data is kept.
+func (s *SQLite) Close() {
+	s.stmts.close()
+	if err := s.db.Close(); err != nil {
+		log.Printf("failed to close connection: %v", err)
+	}
+}
+
+// Exec executes the given statement on the database.
+// It stops at the first failing statement and returns its error.
+func (s *SQLite) Exec(ctx context.Context, stmt string) error {
+	return statement.SQLite.Run(ctx, sqlSession{db: s.db}, stmt)
+}
+
+// Placeholder returns the placeholder of the n-th parameter of a prepared statement.
+func (s *SQLite) Placeholder(n int) string {
+	return statement.SQLite.Placeholder(n)
+}
+
+// ExecPrepared executes the given statement with its parameters bound to args.
+// Each statement is prepared once per connection.
+func (s *SQLite) ExecPrepared(ctx context.Context, stmt string, args []interface{}) error {
+	return execPrepared(ctx, statement.SQLite, s.db, &s.stmts, stmt, args)
+}
+
+// ServerVersion returns the version of the SQLite library, as there is no server.
+func (s *SQLite) ServerVersion(ctx context.Context) (string, error) {
+	return queryVersion(ctx, s.db, "sqlite3")
+}
+
+// Dialect returns the name of the query language, it selects the \dialect sections of scripts.
+func (s *SQLite) Dialect() string {
+	return statement.SQLite.Name
+}
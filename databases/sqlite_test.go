@@ -0,0 +1,220 @@
+package databases
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RomanBoegli/godbbench/benchmark"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLite(t *testing.T) *SQLite {
+	s, err := NewSQLite(SQLiteMemory, "", "", 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Setup())
+	t.Cleanup(func() { s.Cleanup(true) })
+	return s
+}
+
+func count(t *testing.T, s *SQLite, query string) int {
+	var n int
+	require.NoError(t, s.db.QueryRow(query).Scan(&n))
+	return n
+}
+
+func TestSQLiteBenchmarks(t *testing.T) {
+	s := newTestSQLite(t)
+	opts := benchmark.Options{Iter: 100, Threads: 4}
+
+	for _, b := range s.Benchmarks() {
+		result, err := benchmark.Run(context.Background(), s, b, opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, uint64(100), result.TotalExecutionCount, b.Name)
+		assert.Equal(t, uint64(0), result.FailedCount(), "%v: %v", b.Name, result.ErrorSamples())
+		switch b.Name {
+		case "inserts":
+			assert.Equal(t, 100, count(t, s, "SELECT COUNT(*) FROM generic"))
+			assert.Equal(t, uint64(0), result.RowCount)
+		case "selects":
+			// every select returns the inserted row
+			assert.Equal(t, uint64(100), result.RowCount)
+			assert.Greater(t, result.ByteCount, uint64(100*4))
+		case "deletes":
+			assert.Equal(t, 0, count(t, s, "SELECT COUNT(*) FROM generic"))
+		}
+	}
+}
+
+func TestSQLiteBenchmarksWarmup(t *testing.T) {
+	s := newTestSQLite(t)
+	opts := benchmark.Options{Iter: 200, Threads: 4, Warmup: benchmark.Warmup{Iter: 50}}
+
+	for _, b := range s.Benchmarks() {
+		result, err := benchmark.Run(context.Background(), s, b, opts)
+		require.NoError(t, err)
+
+		require.NotNil(t, result.Warmup, b.Name)
+		assert.Equal(t, uint64(0), result.Warmup.FailedCount(), "%v: %v", b.Name, result.Warmup.ErrorSamples())
+		assert.Equal(t, uint64(0), result.FailedCount(), "%v: %v", b.Name, result.ErrorSamples())
+		if b.Name == "inserts" {
+			assert.Equal(t, 250, count(t, s, "SELECT COUNT(*) FROM generic"))
+		}
+	}
+}
+
+func TestSQLiteScript(t *testing.T) {
+	s := newTestSQLite(t)
+
+	benchmarks, err := benchmark.ParseScript(strings.NewReader(`
+		\benchmark once \name setup
+		CREATE TABLE account (id INT PRIMARY KEY, balance INT);
+
+		\benchmark loop \name transfer
+		BEGIN TRANSACTION;
+		INSERT INTO account (id, balance) VALUES ({{.Iter}}, 100);
+		UPDATE account SET balance = balance - 10 WHERE id = {{.Iter}};
+		END;
+		`))
+	require.NoError(t, err)
+
+	for _, b := range benchmarks {
+		result, err := benchmark.Run(context.Background(), s, b, benchmark.Options{Iter: 20, Threads: 2})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), result.FailedCount(), "%v: %v", b.Name, result.ErrorSamples())
+	}
+	assert.Equal(t, 20, count(t, s, "SELECT COUNT(*) FROM account WHERE balance = 90"))
+}
+
+func TestSQLitePrepared(t *testing.T) {
+	s := newTestSQLite(t)
+	opts := benchmark.Options{Iter: 100, Threads: 4, Prepared: true}
+
+	for _, b := range s.Benchmarks() {
+		result, err := benchmark.Run(context.Background(), s, b, opts)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), result.FailedCount(), "%v: %v", b.Name, result.ErrorSamples())
+		if b.Name == "inserts" {
+			assert.Equal(t, 100, count(t, s, "SELECT COUNT(*) FROM generic"))
+		}
+	}
+	assert.Len(t, s.stmts.stmts, 4)
+
+	// the parameters of a transaction are bound to its single statements
+	benchmarks, err := benchmark.ParseScript(strings.NewReader(`
+		\benchmark once \name setup
+		CREATE TABLE account (id INT PRIMARY KEY, name TEXT, balance INT);
+
+		\benchmark loop \name transfer
+		BEGIN;
+		INSERT INTO account (id, name, balance) VALUES ({{param .Iter}}, {{param "it's"}}, 100);
+		UPDATE account SET balance = balance - {{param 10}} WHERE id = {{param .Iter}};
+		COMMIT;
+		`))
+	require.NoError(t, err)
+	for _, b := range benchmarks {
+		result, err := benchmark.Run(context.Background(), s, b, benchmark.Options{Iter: 20, Threads: 2, Prepared: true})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), result.FailedCount(), "%v: %v", b.Name, result.ErrorSamples())
+	}
+	assert.Equal(t, 20, count(t, s, "SELECT COUNT(*) FROM account WHERE balance = 90 AND name = 'it''s'"))
+}
+
+func TestSQLiteExecErrors(t *testing.T) {
+	s := newTestSQLite(t)
+
+	// the first failing statement stops the execution
+	err := s.Exec(context.Background(), "INSERT INTO generic (generic_id) VALUES (1); SELECT * FROM missing; INSERT INTO generic (generic_id) VALUES (2);")
+	assert.Error(t, err)
+	assert.Equal(t, 1, count(t, s, "SELECT COUNT(*) FROM generic"))
+
+	// a failing transaction is rolled back
+	err = s.Exec(context.Background(), "BEGIN; INSERT INTO generic (generic_id) VALUES (3); INSERT INTO generic (generic_id) VALUES (1); COMMIT;")
+	assert.Error(t, err)
+	assert.Equal(t, 0, count(t, s, "SELECT COUNT(*) FROM generic WHERE generic_id = 3"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, s.Exec(ctx, "SELECT * FROM generic;"))
+}
+
+func TestSQLiteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "godbbench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewSQLite(filepath.Join(dir, "bench.db"), "WAL", "NORMAL", 4)
+	require.NoError(t, err)
+	require.NoError(t, s.Setup())
+	defer s.Cleanup(true)
+
+	var mode string
+	require.NoError(t, s.db.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+	assert.Equal(t, 1, count(t, s, "PRAGMA synchronous"))
+
+	result, err := benchmark.Run(context.Background(), s, s.Benchmarks()[0], benchmark.Options{Iter: 50, Threads: 4})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), result.FailedCount(), "%v", result.ErrorSamples())
+	assert.Equal(t, 50, count(t, s, "SELECT COUNT(*) FROM generic"))
+}
+
+func TestSQLiteVerify(t *testing.T) {
+	benchmarks, err := benchmark.ParseScript(strings.NewReader(`
+		\benchmark once \name init
+		CREATE TABLE account (id INT PRIMARY KEY, name TEXT, balance DECIMAL);
+		INSERT INTO account VALUES (1, 'a', 10.5), (2, NULL, 20), (3, 'c', 30);
+
+		\benchmark once \name select \expect rows=3
+		SELECT * FROM account ORDER BY id;
+
+		\benchmark once \name count \expect rows=2
+		SELECT COUNT(*) FROM account;
+		`))
+	require.NoError(t, err)
+
+	first := benchmark.Verify(context.Background(), newTestSQLite(t), benchmarks)
+	second := benchmark.Verify(context.Background(), newTestSQLite(t), benchmarks)
+	require.Len(t, first, 3)
+	assert.Equal(t, uint64(3), first[1].Rows)
+	assert.NotEmpty(t, first[1].Checksum)
+	assert.Equal(t, "expected 2 rows, got 1", first[2].Err)
+
+	got := benchmark.Compare(first, second)
+	require.Len(t, got, 3)
+	assert.True(t, got[0].Match)
+	assert.True(t, got[1].Match)
+	assert.False(t, got[2].Match)
+}
+
+func TestSQLiteServerVersion(t *testing.T) {
+	version, err := newTestSQLite(t).ServerVersion(context.Background())
+	require.NoError(t, err)
+	assert.Regexp(t, `^3\.\d+\.\d+$`, version)
+}
+
+func TestSQLiteDialect(t *testing.T) {
+	s := newTestSQLite(t)
+	benchmarks, err := benchmark.ParseScriptWith(strings.NewReader(`
+		\benchmark once \name init
+		\dialect postgres
+		CREATE TABLE account (id SERIAL PRIMARY KEY, balance INT);
+		\dialect sqlite
+		CREATE TABLE account (id INTEGER PRIMARY KEY AUTOINCREMENT, balance INT);
+		\dialect all
+		INSERT INTO account (balance) VALUES (10);
+		`), benchmark.ParseOptions{Dialect: benchmark.DialectOf(s)})
+	require.NoError(t, err)
+
+	require.Len(t, benchmarks, 1)
+	result, err := benchmark.Run(context.Background(), s, benchmarks[0], benchmark.Options{Iter: 1, Threads: 1})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), result.FailedCount(), "%v", result.ErrorSamples())
+	assert.Equal(t, 1, count(t, s, "SELECT COUNT(*) FROM account"))
+}
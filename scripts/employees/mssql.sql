@@ -0,0 +1,61 @@
+-- INIT
+\benchmark once \name initialize
+DROP TABLE IF EXISTS godbbench.employee;
+DROP SCHEMA IF EXISTS godbbench;
+GO
+CREATE SCHEMA godbbench;
+GO
+BEGIN TRANSACTION;
+    CREATE TABLE godbbench.employee (
+        employeeId INT IDENTITY(1,1) PRIMARY KEY,
+        first_name varchar(50) NOT NULL,
+        boss_id INT NULL,
+        salary INT NULL,
+        FOREIGN KEY (boss_id) REFERENCES godbbench.employee (employeeId));
+    INSERT INTO godbbench.employee (first_name, boss_id, salary) VALUES ('BigBoss', null, 999999);
+COMMIT;
+
+-- INSERT
+\benchmark loop 1.0 \name insert_employee
+INSERT INTO godbbench.employee (first_name, boss_id, salary)
+    VALUES ('{{call .RandString 3 10 }}', (SELECT TOP 1 employeeId FROM godbbench.employee ORDER BY NEWID()), {{call .RandIntBetween 10000 500000 }});
+
+-- SELECT 1
+\benchmark loop 1.0 \name select_before_index
+WITH hierarchy AS (
+    SELECT employeeId, first_name, boss_id, 0 AS level
+    FROM godbbench.employee
+    WHERE employeeId = {{.Iter}}
+    UNION ALL
+    SELECT e.employeeId, e.first_name, e.boss_id, hierarchy.level + 1 AS level
+    FROM godbbench.employee e
+    JOIN hierarchy ON e.boss_id = hierarchy.employeeId
+    )
+SELECT * FROM hierarchy;
+
+-- INDEX
+\benchmark once \name create_index
+CREATE INDEX index_boss_id ON godbbench.employee (boss_id);
+
+-- CACHE
+\benchmark once \name clear_cache
+CHECKPOINT;
+DBCC DROPCLEANBUFFERS;
+
+-- SELECT 2
+\benchmark loop 1.0 \name select_after_index
+WITH hierarchy AS (
+    SELECT employeeId, first_name, boss_id, 0 AS level
+    FROM godbbench.employee
+    WHERE employeeId = {{.Iter}}
+    UNION ALL
+    SELECT e.employeeId, e.first_name, e.boss_id, hierarchy.level + 1 AS level
+    FROM godbbench.employee e
+    JOIN hierarchy ON e.boss_id = hierarchy.employeeId
+    )
+SELECT * FROM hierarchy;
+
+-- CLEAN
+\benchmark once \name clean
+DROP TABLE IF EXISTS godbbench.employee;
+DROP SCHEMA IF EXISTS godbbench;
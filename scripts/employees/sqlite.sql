@@ -0,0 +1,55 @@
+-- INIT
+\benchmark once \name initialize
+DROP TABLE IF EXISTS employee;
+BEGIN TRANSACTION;
+    CREATE TABLE employee (
+        employeeId INTEGER PRIMARY KEY AUTOINCREMENT,
+        first_name varchar(50) NOT NULL,
+        boss_id INT NULL,
+        salary INT NULL,
+        FOREIGN KEY (boss_id) REFERENCES employee (employeeId));
+    INSERT INTO employee (first_name, boss_id, salary) VALUES ('BigBoss', null, 999999);
+COMMIT;
+
+-- INSERT
+\benchmark loop 1.0 \name insert_employee
+INSERT INTO employee (first_name, boss_id, salary)
+    VALUES ('{{call .RandString 3 10 }}', (SELECT employeeId FROM employee ORDER BY RANDOM() LIMIT 1), {{call .RandIntBetween 10000 500000 }});
+
+-- SELECT 1
+\benchmark loop 1.0 \name select_before_index
+WITH RECURSIVE hierarchy AS (
+    SELECT employeeId, first_name, boss_id, 0 AS level
+    FROM employee
+    WHERE employeeId = {{.Iter}}
+    UNION ALL
+    SELECT e.employeeId, e.first_name, e.boss_id, hierarchy.level + 1 AS level
+    FROM employee e
+    JOIN hierarchy ON e.boss_id = hierarchy.employeeId
+    )
+SELECT * FROM hierarchy;
+
+-- INDEX
+\benchmark once \name create_index
+CREATE INDEX index_boss_id ON employee (boss_id);
+
+-- CACHE
+\benchmark once \name clear_cache
+PRAGMA shrink_memory;
+
+-- SELECT 2
+\benchmark loop 1.0 \name select_after_index
+WITH RECURSIVE hierarchy AS (
+    SELECT employeeId, first_name, boss_id, 0 AS level
+    FROM employee
+    WHERE employeeId = {{.Iter}}
+    UNION ALL
+    SELECT e.employeeId, e.first_name, e.boss_id, hierarchy.level + 1 AS level
+    FROM employee e
+    JOIN hierarchy ON e.boss_id = hierarchy.employeeId
+    )
+SELECT * FROM hierarchy;
+
+-- CLEAN
+\benchmark once \name clean
+DROP TABLE IF EXISTS employee;
@@ -0,0 +1,281 @@
+// Package statement splits benchmark statements into single statements and executes
+// them, mapping the transaction control statements of the respective query language
+// to transactions of the database driver.
+package statement
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the lexical rules and the transaction control statements of a
+// query language. Control statements are compared case-insensitively with their
+// whitespace collapsed, e.g. "begin   transaction" matches "BEGIN TRANSACTION".
+type Dialect struct {
+	Name      string
+	Separator string // separates the single statements, e.g. ";"
+	// Param is the placeholder of bound parameters, either "?" or a prefix followed
+	// by the number of the parameter, e.g. "$" for $1, $2 and so on.
+	Param string
+
+	Begin    []string // statements starting a transaction
+	Commit   []string // statements committing a transaction
+	Rollback []string // statements rolling back a transaction
+	// TxModes allows begin statements followed by transaction modes, which are mapped
+	// to the options of the transaction, e.g. "BEGIN ISOLATION LEVEL SERIALIZABLE, READ ONLY".
+	TxModes bool
+
+	// Savepoint, Release and RollbackTo match the savepoint statements, the first
+	// group being the name of the savepoint. Nil if the dialect has no such statement.
+	Savepoint  *regexp.Regexp
+	Release    *regexp.Regexp
+	RollbackTo *regexp.Regexp
+
+	// Formats of the savepoint statements used to nest transactions, the only
+	// argument being the name of the savepoint. Nesting transactions is not
+	// supported if SavepointStmt is empty, releasing is skipped if ReleaseStmt is.
+	SavepointStmt  string
+	ReleaseStmt    string
+	RollbackToStmt string
+
+	DashComments     bool // -- comments up to the end of the line
+	HashComments     bool // # comments up to the end of the line
+	SlashComments    bool // // comments up to the end of the line
+	NestedComments   bool // /* */ comments may be nested
+	BackslashEscapes bool // a backslash escapes the next character within quotes
+	EscapeStrings    bool // E'...' strings with backslash escapes
+	DoubleQuotes     bool // "..." identifiers or strings
+	BacktickQuotes   bool // `...` identifiers
+	BracketQuotes    bool // [...] identifiers
+	DollarQuotes     bool // $tag$...$tag$ strings, e.g. function bodies
+	Blocks           bool // BEGIN ... END and CASE ... END blocks may contain separators
+	ColonCommands    bool // statements starting with a colon, e.g. :begin, end at the line end
+}
+
+var (
+	// Standard is ANSI SQL, the basis of the generic sql bencher.
+	Standard = &Dialect{
+		Name:           "standard",
+		Separator:      ";",
+		Param:          "?",
+		Begin:          []string{"BEGIN", "BEGIN WORK", "BEGIN TRANSACTION", "START TRANSACTION"},
+		Commit:         []string{"COMMIT", "COMMIT WORK"},
+		Rollback:       []string{"ROLLBACK", "ROLLBACK WORK"},
+		TxModes:        true,
+		Savepoint:      regexp.MustCompile(`(?i)^SAVEPOINT (\S+)$`),
+		Release:        regexp.MustCompile(`(?i)^RELEASE (?:SAVEPOINT )?(\S+)$`),
+		RollbackTo:     regexp.MustCompile(`(?i)^ROLLBACK (?:WORK )?TO (?:SAVEPOINT )?(\S+)$`),
+		SavepointStmt:  "SAVEPOINT %v",
+		ReleaseStmt:    "RELEASE SAVEPOINT %v",
+		RollbackToStmt: "ROLLBACK TO SAVEPOINT %v",
+		DashComments:   true,
+		DoubleQuotes:   true,
+		Blocks:         true,
+	}
+
+	// Postgres is the SQL dialect of PostgreSQL.
+	Postgres = &Dialect{
+		Name:           "postgres",
+		Separator:      ";",
+		Param:          "$",
+		Begin:          []string{"BEGIN", "BEGIN WORK", "BEGIN TRANSACTION", "START TRANSACTION"},
+		Commit:         []string{"COMMIT", "COMMIT WORK", "COMMIT TRANSACTION", "END", "END WORK", "END TRANSACTION"},
+		Rollback:       []string{"ROLLBACK", "ROLLBACK WORK", "ROLLBACK TRANSACTION", "ABORT", "ABORT WORK", "ABORT TRANSACTION"},
+		TxModes:        true,
+		Savepoint:      regexp.MustCompile(`(?i)^SAVEPOINT (\S+)$`),
+		Release:        regexp.MustCompile(`(?i)^RELEASE (?:SAVEPOINT )?(\S+)$`),
+		RollbackTo:     regexp.MustCompile(`(?i)^ROLLBACK (?:WORK |TRANSACTION )?TO (?:SAVEPOINT )?(\S+)$`),
+		SavepointStmt:  "SAVEPOINT %v",
+		ReleaseStmt:    "RELEASE SAVEPOINT %v",
+		RollbackToStmt: "ROLLBACK TO SAVEPOINT %v",
+		DashComments:   true,
+		NestedComments: true,
+		EscapeStrings:  true,
+		DoubleQuotes:   true,
+		DollarQuotes:   true,
+		Blocks:         true,
+	}
+
+	// MySQL is the SQL dialect of MySQL and MariaDB.
+	MySQL = &Dialect{
+		Name:             "mysql",
+		Separator:        ";",
+		Param:            "?",
+		Begin:            []string{"BEGIN", "BEGIN WORK", "START TRANSACTION"},
+		Commit:           []string{"COMMIT", "COMMIT WORK"},
+		Rollback:         []string{"ROLLBACK", "ROLLBACK WORK"},
+		TxModes:          true,
+		Savepoint:        regexp.MustCompile(`(?i)^SAVEPOINT (\S+)$`),
+		Release:          regexp.MustCompile(`(?i)^RELEASE SAVEPOINT (\S+)$`),
+		RollbackTo:       regexp.MustCompile(`(?i)^ROLLBACK (?:WORK )?TO (?:SAVEPOINT )?(\S+)$`),
+		SavepointStmt:    "SAVEPOINT %v",
+		ReleaseStmt:      "RELEASE SAVEPOINT %v",
+		RollbackToStmt:   "ROLLBACK TO SAVEPOINT %v",
+		DashComments:     true,
+		HashComments:     true,
+		BackslashEscapes: true,
+		DoubleQuotes:     true,
+		BacktickQuotes:   true,
+		Blocks:           true,
+	}
+
+	// SQLite is the SQL dialect of SQLite.
+	SQLite = &Dialect{
+		Name:           "sqlite",
+		Separator:      ";",
+		Param:          "?",
+		Begin:          []string{"BEGIN", "BEGIN TRANSACTION", "BEGIN DEFERRED", "BEGIN DEFERRED TRANSACTION", "BEGIN IMMEDIATE", "BEGIN IMMEDIATE TRANSACTION", "BEGIN EXCLUSIVE", "BEGIN EXCLUSIVE TRANSACTION"},
+		Commit:         []string{"COMMIT", "COMMIT TRANSACTION", "END", "END TRANSACTION"},
+		Rollback:       []string{"ROLLBACK", "ROLLBACK TRANSACTION"},
+		Savepoint:      regexp.MustCompile(`(?i)^SAVEPOINT (\S+)$`),
+		Release:        regexp.MustCompile(`(?i)^RELEASE (?:SAVEPOINT )?(\S+)$`),
+		RollbackTo:     regexp.MustCompile(`(?i)^ROLLBACK (?:TRANSACTION )?TO (?:SAVEPOINT )?(\S+)$`),
+		SavepointStmt:  "SAVEPOINT %v",
+		ReleaseStmt:    "RELEASE SAVEPOINT %v",
+		RollbackToStmt: "ROLLBACK TO SAVEPOINT %v",
+		DashComments:   true,
+		DoubleQuotes:   true,
+		BacktickQuotes: true,
+		BracketQuotes:  true,
+		Blocks:         true,
+	}
+
+	// MSSQL is Transact-SQL, the SQL dialect of Microsoft SQL Server.
+	MSSQL = &Dialect{
+		Name:           "mssql",
+		Separator:      ";",
+		Param:          "@p",
+		Begin:          []string{"BEGIN TRAN", "BEGIN TRANSACTION"},
+		Commit:         []string{"COMMIT", "COMMIT TRAN", "COMMIT TRANSACTION", "COMMIT WORK"},
+		Rollback:       []string{"ROLLBACK", "ROLLBACK TRAN", "ROLLBACK TRANSACTION", "ROLLBACK WORK"},
+		Savepoint:      regexp.MustCompile(`(?i)^SAVE TRAN(?:SACTION)? (\S+)$`),
+		RollbackTo:     regexp.MustCompile(`(?i)^ROLLBACK TRAN(?:SACTION)? (\S+)$`),
+		SavepointStmt:  "SAVE TRANSACTION %v",
+		RollbackToStmt: "ROLLBACK TRANSACTION %v",
+		DashComments:   true,
+		NestedComments: true,
+		DoubleQuotes:   true,
+		BracketQuotes:  true,
+		Blocks:         true,
+	}
+
+	// Cypher is the query language of Neo4j, with the transaction commands of cypher-shell.
+	Cypher = &Dialect{
+		Name:             "cypher",
+		Separator:        ";",
+		Param:            "$p",
+		Begin:            []string{":BEGIN"},
+		Commit:           []string{":COMMIT"},
+		Rollback:         []string{":ROLLBACK"},
+		SlashComments:    true,
+		BackslashEscapes: true,
+		DoubleQuotes:     true,
+		BacktickQuotes:   true,
+		ColonCommands:    true,
+	}
+)
+
+// Dialects lists the predefined dialects by name.
+var Dialects = map[string]*Dialect{}
+
+func init() {
+	for _, d := range []*Dialect{Standard, Postgres, MySQL, SQLite, MSSQL, Cypher} {
+		Dialects[d.Name] = d
+	}
+}
+
+// Lookup returns the predefined dialect of the given name.
+func Lookup(name string) (*Dialect, error) {
+	if d, ok := Dialects[name]; ok {
+		return d, nil
+	}
+	names := make([]string, 0, len(Dialects))
+	for n := range Dialects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown dialect %q, available dialects: %v", name, strings.Join(names, ", "))
+}
+
+// Placeholder returns the placeholder of the n-th bound parameter, starting at 1.
+func (d *Dialect) Placeholder(n int) string {
+	if d.Param == "?" {
+		return d.Param
+	}
+	return d.Param + strconv.Itoa(n)
+}
+
+// normalize makes statements comparable regardless of case and whitespace.
+func normalize(stmt string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(stmt)), " ")
+}
+
+// prefix returns the longest of the tokens the normalized statement starts with,
+// followed by further words. It returns "" if there is none.
+func prefix(tokens []string, norm string) string {
+	longest := ""
+	for _, t := range tokens {
+		t = normalize(t)
+		if len(t) > len(longest) && strings.HasPrefix(norm, t+" ") {
+			longest = t
+		}
+	}
+	return longest
+}
+
+func matches(tokens []string, norm string) bool {
+	for _, t := range tokens {
+		if normalize(t) == norm {
+			return true
+		}
+	}
+	return false
+}
+
+// isolationLevels are the isolation levels of transaction modes, see TxModes.
+var isolationLevels = map[string]sql.IsolationLevel{
+	"READ UNCOMMITTED": sql.LevelReadUncommitted,
+	"READ COMMITTED":   sql.LevelReadCommitted,
+	"REPEATABLE READ":  sql.LevelRepeatableRead,
+	"SNAPSHOT":         sql.LevelSnapshot,
+	"SERIALIZABLE":     sql.LevelSerializable,
+}
+
+// txOptions maps the normalized transaction modes following a begin statement to the
+// options of the transaction. The modes are separated by commas or whitespace.
+func (d *Dialect) txOptions(modes string) (*sql.TxOptions, error) {
+	if !d.TxModes {
+		return nil, fmt.Errorf("transaction options %q are not supported by %v", modes, d.Name)
+	}
+	opts := &sql.TxOptions{}
+	words := strings.Fields(strings.ReplaceAll(modes, ",", " "))
+	for len(words) > 0 {
+		switch {
+		case len(words) > 2 && words[0] == "ISOLATION" && words[1] == "LEVEL":
+			n := 1 // words of the level, e.g. 2 for READ COMMITTED
+			level, ok := isolationLevels[words[2]]
+			if !ok && len(words) > 3 {
+				n = 2
+				level, ok = isolationLevels[words[2]+" "+words[3]]
+			}
+			if !ok {
+				return nil, fmt.Errorf("unknown isolation level %q", strings.Join(words[2:], " "))
+			}
+			opts.Isolation = level
+			words = words[2+n:]
+		case len(words) > 1 && words[0] == "READ" && words[1] == "ONLY":
+			opts.ReadOnly = true
+			words = words[2:]
+		case len(words) > 1 && words[0] == "READ" && words[1] == "WRITE":
+			opts.ReadOnly = false
+			words = words[2:]
+		default:
+			return nil, fmt.Errorf("transaction option %q is not supported by %v", strings.Join(words, " "), d.Name)
+		}
+	}
+	return opts, nil
+}
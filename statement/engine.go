@@ -0,0 +1,184 @@
+package statement
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Session executes statements on a database, either on their own or within a transaction.
+// The arguments are the values of the bound parameters of the statement, if any.
+// Query executes a statement returning rows and reads all of them.
+type Session interface {
+	Exec(ctx context.Context, stmt string, args ...interface{}) error
+	Query(ctx context.Context, stmt string, args ...interface{}) error
+	Begin(ctx context.Context, opts *sql.TxOptions) (Tx, error)
+}
+
+// Tx is a transaction of a Session.
+type Tx interface {
+	Exec(ctx context.Context, stmt string, args ...interface{}) error
+	Query(ctx context.Context, stmt string, args ...interface{}) error
+	Commit() error
+	Rollback() error
+}
+
+// Run splits the script into its statements and executes them, see Exec.
+func (d *Dialect) Run(ctx context.Context, s Session, script string) error {
+	return d.Exec(ctx, s, d.Split(script))
+}
+
+// RunArgs splits the script into its statements, binds their parameters to args
+// and executes them, see Bind and Exec.
+func (d *Dialect) RunArgs(ctx context.Context, s Session, script string, args []interface{}) error {
+	stmts, err := d.Bind(script, args)
+	if err != nil {
+		return err
+	}
+	return d.Exec(ctx, s, stmts)
+}
+
+// Exec executes the statements one after another and stops at the first failing one,
+// whose error is returned. A failing transaction is rolled back.
+//
+// Transaction control statements are mapped to transactions of the session:
+// statements between a begin and a commit statement are executed within a single
+// transaction, which a rollback statement rolls back instead. A begin statement
+// within a transaction nests a transaction by setting a savepoint, which the next
+// commit statement releases and a rollback statement rolls back to. A savepoint set
+// outside a transaction starts one, which is committed when the savepoint is released.
+// Commit and rollback statements outside a transaction are ignored.
+// The transaction modes of a begin statement, e.g. its isolation level, are passed
+// to the session as options, see TxModes. Nested transactions can't have any.
+func (d *Dialect) Exec(ctx context.Context, s Session, stmts []Statement) error {
+	e := &execution{d: d, s: s}
+	for _, stmt := range stmts {
+		if err := e.exec(ctx, stmt); err != nil {
+			if e.tx != nil {
+				e.tx.Rollback()
+			}
+			return err
+		}
+	}
+	if e.tx != nil {
+		e.tx.Rollback()
+		return fmt.Errorf("transaction was neither committed nor rolled back")
+	}
+	return nil
+}
+
+// execution keeps track of the transaction state while executing statements.
+type execution struct {
+	d      *Dialect
+	s      Session
+	tx     Tx
+	nested []string // savepoints of the nested transactions, innermost last
+	// savepoint which started the transaction, releasing it commits the transaction
+	outermost string
+}
+
+func (e *execution) exec(ctx context.Context, stmt Statement) error {
+	switch stmt.Kind {
+	case Begin:
+		if stmt.err != nil {
+			return stmt.err
+		}
+		if e.tx == nil {
+			return e.begin(ctx, stmt.TxOptions)
+		}
+		if e.d.SavepointStmt == "" {
+			return fmt.Errorf("nested transactions are not supported by %v", e.d.Name)
+		}
+		if stmt.TxOptions != nil {
+			return fmt.Errorf("nested transactions can't have transaction options")
+		}
+		name := fmt.Sprintf("godbbench_nested_%v", len(e.nested)+1)
+		if err := e.tx.Exec(ctx, fmt.Sprintf(e.d.SavepointStmt, name)); err != nil {
+			return err
+		}
+		e.nested = append(e.nested, name)
+		return nil
+
+	case Commit:
+		if e.tx == nil {
+			return nil
+		}
+		if len(e.nested) > 0 {
+			name := e.nested[len(e.nested)-1]
+			e.nested = e.nested[:len(e.nested)-1]
+			if e.d.ReleaseStmt == "" {
+				return nil
+			}
+			return e.tx.Exec(ctx, fmt.Sprintf(e.d.ReleaseStmt, name))
+		}
+		return e.commit()
+
+	case Rollback:
+		if e.tx == nil {
+			return nil
+		}
+		if len(e.nested) > 0 {
+			name := e.nested[len(e.nested)-1]
+			e.nested = e.nested[:len(e.nested)-1]
+			if err := e.tx.Exec(ctx, fmt.Sprintf(e.d.RollbackToStmt, name)); err != nil {
+				return err
+			}
+			if e.d.ReleaseStmt == "" {
+				return nil
+			}
+			return e.tx.Exec(ctx, fmt.Sprintf(e.d.ReleaseStmt, name))
+		}
+		tx := e.tx
+		e.reset()
+		return tx.Rollback()
+
+	case Savepoint:
+		if e.tx == nil {
+			if err := e.begin(ctx, nil); err != nil {
+				return err
+			}
+			e.outermost = stmt.Savepoint
+		}
+		return e.tx.Exec(ctx, stmt.Text, stmt.Args...)
+
+	case Release:
+		if e.tx != nil && e.outermost != "" && strings.EqualFold(stmt.Savepoint, e.outermost) {
+			return e.commit()
+		}
+	}
+
+	switch {
+	case e.tx != nil && stmt.Query:
+		return e.tx.Query(ctx, stmt.Text, stmt.Args...)
+	case e.tx != nil:
+		return e.tx.Exec(ctx, stmt.Text, stmt.Args...)
+	case stmt.Query:
+		return e.s.Query(ctx, stmt.Text, stmt.Args...)
+	}
+	return e.s.Exec(ctx, stmt.Text, stmt.Args...)
+}
+
+func (e *execution) begin(ctx context.Context, opts *sql.TxOptions) error {
+	tx, err := e.s.Begin(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	e.tx = tx
+	return nil
+}
+
+func (e *execution) commit() error {
+	tx := e.tx
+	e.reset()
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (e *execution) reset() {
+	e.tx = nil
+	e.nested = nil
+	e.outermost = ""
+}
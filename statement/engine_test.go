@@ -0,0 +1,220 @@
+package statement
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a Session logging all calls, statements containing "fail" fail.
+type recorder struct {
+	log []string
+}
+
+func (r *recorder) record(call, stmt string, args []interface{}) error {
+	entry := call + " " + stmt
+	if len(args) > 0 {
+		entry += fmt.Sprint(" ", args)
+	}
+	r.log = append(r.log, entry)
+	if strings.Contains(stmt, "fail") {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (r *recorder) Exec(ctx context.Context, stmt string, args ...interface{}) error {
+	return r.record("exec", stmt, args)
+}
+
+func (r *recorder) Query(ctx context.Context, stmt string, args ...interface{}) error {
+	return r.record("query", stmt, args)
+}
+
+func (r *recorder) Begin(ctx context.Context, opts *sql.TxOptions) (Tx, error) {
+	entry := "begin"
+	if opts != nil {
+		entry += fmt.Sprintf(" %v read-only=%v", opts.Isolation, opts.ReadOnly)
+	}
+	r.log = append(r.log, entry)
+	return &recorderTx{r}, nil
+}
+
+type recorderTx struct {
+	r *recorder
+}
+
+func (t *recorderTx) Exec(ctx context.Context, stmt string, args ...interface{}) error {
+	return t.r.record("tx", stmt, args)
+}
+
+func (t *recorderTx) Query(ctx context.Context, stmt string, args ...interface{}) error {
+	return t.r.record("tx query", stmt, args)
+}
+
+func (t *recorderTx) Commit() error {
+	t.r.log = append(t.r.log, "commit")
+	return nil
+}
+
+func (t *recorderTx) Rollback() error {
+	t.r.log = append(t.r.log, "rollback")
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		description string
+		dialect     *Dialect
+		in          string
+		want        []string
+		err         string
+	}{
+		{
+			description: "postgres/transaction",
+			dialect:     Postgres,
+			in:          "SELECT 1; BEGIN; INSERT 1; INSERT 2; COMMIT; SELECT 2;",
+			want:        []string{"query SELECT 1", "begin", "tx INSERT 1", "tx INSERT 2", "commit", "query SELECT 2"},
+		},
+		{
+			description: "postgres/rollback",
+			dialect:     Postgres,
+			in:          "BEGIN; INSERT 1; ROLLBACK; SELECT 1;",
+			want:        []string{"begin", "tx INSERT 1", "rollback", "query SELECT 1"},
+		},
+		{
+			description: "postgres/failure rolls back",
+			dialect:     Postgres,
+			in:          "BEGIN; INSERT 1; fail; INSERT 2; COMMIT;",
+			want:        []string{"begin", "tx INSERT 1", "tx fail", "rollback"},
+			err:         "failed",
+		},
+		{
+			description: "postgres/failure stops",
+			dialect:     Postgres,
+			in:          "SELECT 1; fail; SELECT 2;",
+			want:        []string{"query SELECT 1", "exec fail"},
+			err:         "failed",
+		},
+		{
+			description: "postgres/savepoints",
+			dialect:     Postgres,
+			in:          "BEGIN; INSERT 1; SAVEPOINT a; INSERT 2; ROLLBACK TO SAVEPOINT a; RELEASE a; COMMIT;",
+			want:        []string{"begin", "tx INSERT 1", "tx SAVEPOINT a", "tx INSERT 2", "tx ROLLBACK TO SAVEPOINT a", "tx RELEASE a", "commit"},
+		},
+		{
+			description: "postgres/nested transactions",
+			dialect:     Postgres,
+			in:          "BEGIN; INSERT 1; BEGIN; INSERT 2; BEGIN; INSERT 3; ROLLBACK; COMMIT; COMMIT;",
+			want: []string{
+				"begin", "tx INSERT 1",
+				"tx SAVEPOINT godbbench_nested_1", "tx INSERT 2",
+				"tx SAVEPOINT godbbench_nested_2", "tx INSERT 3",
+				"tx ROLLBACK TO SAVEPOINT godbbench_nested_2", "tx RELEASE SAVEPOINT godbbench_nested_2",
+				"tx RELEASE SAVEPOINT godbbench_nested_1",
+				"commit",
+			},
+		},
+		{
+			description: "postgres/missing commit",
+			dialect:     Postgres,
+			in:          "BEGIN; INSERT 1;",
+			want:        []string{"begin", "tx INSERT 1", "rollback"},
+			err:         "transaction was neither committed nor rolled back",
+		},
+		{
+			description: "postgres/commit outside of a transaction",
+			dialect:     Postgres,
+			in:          "COMMIT; ROLLBACK; SELECT 1;",
+			want:        []string{"query SELECT 1"},
+		},
+		{
+			description: "postgres/transaction modes",
+			dialect:     Postgres,
+			in:          "BEGIN ISOLATION LEVEL SERIALIZABLE; INSERT 1; COMMIT; START TRANSACTION READ ONLY, ISOLATION LEVEL READ COMMITTED; SELECT 1; COMMIT;",
+			want:        []string{"begin Serializable read-only=false", "tx INSERT 1", "commit", "begin Read Committed read-only=true", "tx query SELECT 1", "commit"},
+		},
+		{
+			description: "postgres/unsupported transaction modes",
+			dialect:     Postgres,
+			in:          "SELECT 1; BEGIN ISOLATION LEVEL SERIALIZABLE DEFERRABLE; INSERT 1; COMMIT;",
+			want:        []string{"query SELECT 1"},
+			err:         `transaction option "DEFERRABLE" is not supported by postgres`,
+		},
+		{
+			description: "postgres/nested transaction modes",
+			dialect:     Postgres,
+			in:          "BEGIN; BEGIN READ ONLY; COMMIT; COMMIT;",
+			want:        []string{"begin", "rollback"},
+			err:         "nested transactions can't have transaction options",
+		},
+		{
+			description: "mysql/transaction",
+			dialect:     MySQL,
+			in:          "START TRANSACTION; INSERT 'a;b'; COMMIT; BEGIN WORK; INSERT 2; ROLLBACK WORK;",
+			want:        []string{"begin", "tx INSERT 'a;b'", "commit", "begin", "tx INSERT 2", "rollback"},
+		},
+		{
+			description: "mysql/read only transaction",
+			dialect:     MySQL,
+			in:          "START TRANSACTION READ ONLY; SELECT 1; COMMIT; START TRANSACTION WITH CONSISTENT SNAPSHOT;",
+			want:        []string{"begin Default read-only=true", "tx query SELECT 1", "commit"},
+			err:         `transaction option "WITH CONSISTENT SNAPSHOT" is not supported by mysql`,
+		},
+		{
+			description: "sqlite/savepoint starts a transaction",
+			dialect:     SQLite,
+			in:          "SAVEPOINT a; INSERT 1; SAVEPOINT b; INSERT 2; RELEASE b; RELEASE a; SELECT 1;",
+			want:        []string{"begin", "tx SAVEPOINT a", "tx INSERT 1", "tx SAVEPOINT b", "tx INSERT 2", "tx RELEASE b", "commit", "query SELECT 1"},
+		},
+		{
+			description: "mssql/nested transactions",
+			dialect:     MSSQL,
+			in:          "BEGIN TRAN; BEGIN TRANSACTION; INSERT 1; ROLLBACK TRAN; COMMIT TRAN;",
+			want:        []string{"begin", "tx SAVE TRANSACTION godbbench_nested_1", "tx INSERT 1", "tx ROLLBACK TRANSACTION godbbench_nested_1", "commit"},
+		},
+		{
+			description: "cypher/transaction",
+			dialect:     Cypher,
+			in:          ":begin\nCREATE (n);\nCREATE (m);\n:commit\nMATCH (n) RETURN n;",
+			want:        []string{"begin", "tx CREATE (n)", "tx CREATE (m)", "commit", "query MATCH (n) RETURN n"},
+		},
+		{
+			description: "cypher/nested transactions",
+			dialect:     Cypher,
+			in:          ":begin\n:begin\n:commit\n:commit",
+			want:        []string{"begin", "rollback"},
+			err:         "nested transactions are not supported by cypher",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			r := &recorder{}
+			err := tt.dialect.Run(context.Background(), r, tt.in)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+			assert.Equal(t, tt.want, r.log)
+		})
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	r := &recorder{}
+	err := Postgres.RunArgs(context.Background(), r, "BEGIN; INSERT $1, $2; UPDATE $3 WHERE $2; COMMIT;", []interface{}{1, "a", 2.5})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"begin", "tx INSERT $1, $2 [1 a]", "tx UPDATE $1 WHERE $2 [2.5 a]", "commit"}, r.log)
+
+	r = &recorder{}
+	err = Postgres.RunArgs(context.Background(), r, "SELECT $2;", []interface{}{1})
+	assert.EqualError(t, err, "parameter $2 is out of range, 1 arguments given")
+	assert.Empty(t, r.log)
+}
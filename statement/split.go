@@ -0,0 +1,535 @@
+package statement
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Kind classifies a statement.
+type Kind int
+
+const (
+	// Plain is any statement other than a transaction control statement.
+	Plain Kind = iota
+	// Begin starts a transaction.
+	Begin
+	// Commit commits a transaction.
+	Commit
+	// Rollback rolls back a transaction.
+	Rollback
+	// Savepoint sets a savepoint within a transaction.
+	Savepoint
+	// Release releases a savepoint.
+	Release
+	// RollbackTo rolls back a transaction to a savepoint.
+	RollbackTo
+)
+
+// Statement is a single statement of a script.
+type Statement struct {
+	Text      string // the statement as written, without its separator
+	Kind      Kind
+	Savepoint string         // name of the savepoint of savepoint statements
+	TxOptions *sql.TxOptions // options of begin statements with transaction modes, see TxModes
+	Args      []interface{}  // values of the bound parameters, see Bind
+	Query     bool           // whether the statement returns rows, e.g. a SELECT
+	err       error          // why the statement can't be executed, e.g. unsupported transaction modes
+}
+
+// Split splits the script into its single statements. Separators within quotes,
+// comments and blocks are ignored, as are statements consisting of comments only.
+func (d *Dialect) Split(script string) []Statement {
+	stmts, _ := d.split(script, nil)
+	return stmts
+}
+
+// Bind splits the script like Split and binds its parameters to args. The
+// placeholders of the script are numbered across all its statements, see
+// Placeholder. Each statement gets the arguments of its own placeholders,
+// which are renumbered to start at 1 again.
+func (d *Dialect) Bind(script string, args []interface{}) ([]Statement, error) {
+	if d.Param == "" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("bound parameters are not supported by %v", d.Name)
+		}
+		return d.Split(script), nil
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	return d.split(script, args)
+}
+
+// split implements Split and, if args is not nil, Bind.
+func (d *Dialect) split(script string, args []interface{}) ([]Statement, error) {
+	l := &lexer{d: d, src: script, leading: true, bind: args != nil}
+	stmts := []Statement{}
+	for {
+		text, code, ok := l.next()
+		if code != "" {
+			stmt := Statement{Text: text}
+			d.classify(&stmt, code)
+			stmt.Query = stmt.Kind == Plain && returnsRows(code)
+			if l.bind {
+				if err := d.bindParams(&stmt, l.textPos, l.params, args); err != nil {
+					return nil, err
+				}
+			}
+			stmts = append(stmts, stmt)
+		}
+		if !ok {
+			return stmts, nil
+		}
+	}
+}
+
+// bindParams renumbers the placeholders of the statement starting at textPos
+// and assigns the arguments they refer to.
+func (d *Dialect) bindParams(stmt *Statement, textPos int, params []param, args []interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	sb := &strings.Builder{}
+	local := map[int]int{} // number of each parameter within the statement
+	last := 0
+	for _, p := range params {
+		if p.n < 1 || p.n > len(args) {
+			return fmt.Errorf("parameter %v is out of range, %v arguments given", d.Placeholder(p.n), len(args))
+		}
+		n, ok := local[p.n]
+		if !ok || d.Param == "?" {
+			stmt.Args = append(stmt.Args, args[p.n-1])
+			n = len(stmt.Args)
+			local[p.n] = n
+		}
+		sb.WriteString(stmt.Text[last : p.pos-textPos])
+		sb.WriteString(d.Placeholder(n))
+		last = p.end - textPos
+	}
+	sb.WriteString(stmt.Text[last:])
+	stmt.Text = sb.String()
+	return nil
+}
+
+// classify determines the kind of a statement by its code, i.e. its text without comments.
+// A begin statement may be followed by transaction modes, whose options are assigned as well.
+func (d *Dialect) classify(stmt *Statement, code string) {
+	norm := normalize(code)
+	switch {
+	case matches(d.Begin, norm):
+		stmt.Kind = Begin
+		return
+	case matches(d.Commit, norm):
+		stmt.Kind = Commit
+		return
+	case matches(d.Rollback, norm):
+		stmt.Kind = Rollback
+		return
+	}
+	if begin := prefix(d.Begin, norm); begin != "" {
+		// not executed as a plain statement in any case, as it would start a
+		// transaction the engine doesn't know of
+		stmt.Kind = Begin
+		stmt.TxOptions, stmt.err = d.txOptions(norm[len(begin)+1:])
+		return
+	}
+
+	code = strings.Join(strings.Fields(code), " ")
+	for _, p := range []struct {
+		kind Kind
+		re   *regexp.Regexp
+	}{{Savepoint, d.Savepoint}, {Release, d.Release}, {RollbackTo, d.RollbackTo}} {
+		if p.re == nil {
+			continue
+		}
+		if m := p.re.FindStringSubmatch(code); m != nil {
+			stmt.Kind, stmt.Savepoint = p.kind, m[1]
+			return
+		}
+	}
+}
+
+// queryKeywords start statements returning rows.
+var queryKeywords = map[string]bool{
+	"SELECT": true, "WITH": true, "VALUES": true, "TABLE": true, "SHOW": true,
+	"EXPLAIN": true, "DESCRIBE": true, "DESC": true, "PRAGMA": true, "MATCH": true,
+}
+
+// returningKeywords make any statement return rows, e.g. INSERT ... RETURNING.
+var returningKeywords = map[string]bool{
+	"RETURNING": true, "OUTPUT": true, "RETURN": true,
+}
+
+// returnsRows reports whether the statement with the given code returns rows.
+// It errs on the side of caution, as reading the rows of any other statement
+// just finds none.
+func returnsRows(code string) bool {
+	words := strings.FieldsFunc(code, func(r rune) bool { return r > 0x7f || !isWordChar(byte(r)) })
+	for i, w := range words {
+		w = strings.ToUpper(w)
+		if (i == 0 && queryKeywords[w]) || returningKeywords[w] {
+			return true
+		}
+	}
+	return false
+}
+
+// lexer scans a script statement by statement.
+type lexer struct {
+	d       *Dialect
+	src     string
+	pos     int
+	code    strings.Builder // the current statement without comments
+	depth   int             // nesting of BEGIN/CASE ... END blocks
+	leading bool            // whether no word of the current statement was scanned yet
+	cond    int             // end of the last IF or WHILE within code, whose body may be a block, or -1
+
+	bind    bool    // whether to keep track of the placeholders
+	params  []param // placeholders of the current statement
+	count   int     // placeholders "?" scanned so far, they are numbered consecutively
+	textPos int     // position of the text of the current statement within src
+}
+
+// param is a placeholder at src[pos:end] referring to the n-th argument.
+type param struct {
+	pos, end, n int
+}
+
+// next scans the next statement and returns its text and code, ok is false at the end of the script.
+func (l *lexer) next() (text, code string, ok bool) {
+	start := l.pos
+	l.code.Reset()
+	l.depth = 0
+	l.leading = true
+	l.cond = -1
+	l.params = nil
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+
+		// colon commands end at the end of their line
+		if l.d.ColonCommands && l.leading && c == ':' {
+			end := strings.IndexAny(l.src[l.pos:], "\n"+l.d.Separator[:1])
+			if end < 0 {
+				end = len(l.src) - l.pos
+			}
+			// client commands aren't sent to the server, so leading comments are dropped
+			text = l.src[l.pos : l.pos+end]
+			l.textPos = l.pos
+			l.code.WriteString(text)
+			l.pos += end
+			if strings.HasPrefix(l.src[l.pos:], l.d.Separator) {
+				l.pos += len(l.d.Separator)
+			} else if l.pos < len(l.src) {
+				l.pos++ // newline
+			}
+			return strings.TrimSpace(text), strings.TrimSpace(l.code.String()), l.pos < len(l.src)
+		}
+
+		if l.depth == 0 && strings.HasPrefix(l.src[l.pos:], l.d.Separator) {
+			text = l.text(start, l.pos)
+			l.pos += len(l.d.Separator)
+			return text, strings.TrimSpace(l.code.String()), true
+		}
+
+		switch {
+		case l.d.DashComments && strings.HasPrefix(l.src[l.pos:], "--"),
+			l.d.SlashComments && strings.HasPrefix(l.src[l.pos:], "//"),
+			l.d.HashComments && c == '#':
+			l.skipLine()
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			l.skipBlockComment()
+		case c == '\'':
+			l.quoted('\'', l.d.BackslashEscapes)
+		case c == '"' && l.d.DoubleQuotes:
+			l.quoted('"', l.d.BackslashEscapes)
+		case c == '`' && l.d.BacktickQuotes:
+			l.quoted('`', false)
+		case c == '[' && l.d.BracketQuotes:
+			l.quoted(']', false)
+		case c == '$' && l.d.DollarQuotes && l.dollarQuoted():
+		case isWordStart(c):
+			l.word()
+		case l.bind && l.placeholder():
+		default:
+			if !isSpace(c) {
+				l.leading = false
+			}
+			l.code.WriteByte(c)
+			l.pos++
+		}
+	}
+	return l.text(start, len(l.src)), strings.TrimSpace(l.code.String()), false
+}
+
+// text returns src[start:end] without surrounding whitespace and remembers its position.
+func (l *lexer) text(start, end int) string {
+	raw := l.src[start:end]
+	l.textPos = start + len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace))
+	return strings.TrimSpace(raw)
+}
+
+// placeholder scans a placeholder of a bound parameter, it returns false if there is none at the current position.
+func (l *lexer) placeholder() bool {
+	p := l.d.Param
+	if p == "" || !strings.HasPrefix(l.src[l.pos:], p) {
+		return false
+	}
+	end := l.pos + len(p)
+	n := 0
+	if p == "?" {
+		l.count++
+		n = l.count
+	} else {
+		for end < len(l.src) && isDigit(l.src[end]) {
+			n = n*10 + int(l.src[end]-'0')
+			end++
+		}
+		if end == l.pos+len(p) || (end < len(l.src) && isWordChar(l.src[end])) {
+			return false // e.g. the variable @param
+		}
+	}
+	l.params = append(l.params, param{pos: l.pos, end: end, n: n})
+	l.code.WriteString(l.src[l.pos:end])
+	l.leading = false
+	l.pos = end
+	return true
+}
+
+// skipLine skips a comment up to the end of the line.
+func (l *lexer) skipLine() {
+	end := strings.IndexByte(l.src[l.pos:], '\n')
+	if end < 0 {
+		l.pos = len(l.src)
+	} else {
+		l.pos += end
+	}
+	l.code.WriteByte(' ')
+}
+
+// skipBlockComment skips a /* */ comment.
+func (l *lexer) skipBlockComment() {
+	depth := 0
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			if depth == 0 || l.d.NestedComments {
+				depth++
+			}
+			l.pos += 2
+		case strings.HasPrefix(l.src[l.pos:], "*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				l.code.WriteByte(' ')
+				return
+			}
+		default:
+			l.pos++
+		}
+	}
+	l.code.WriteByte(' ')
+}
+
+// quoted scans a quoted string or identifier ending with the given quote, which
+// is escaped by doubling it or, if backslash is set, by a preceding backslash.
+func (l *lexer) quoted(quote byte, backslash bool) {
+	start := l.pos
+	l.pos++ // opening quote
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		l.pos++
+		if backslash && c == '\\' {
+			l.pos++
+			continue
+		}
+		if c == quote {
+			if l.pos < len(l.src) && l.src[l.pos] == quote {
+				l.pos++
+				continue
+			}
+			break
+		}
+	}
+	if l.pos > len(l.src) {
+		l.pos = len(l.src)
+	}
+	l.code.WriteString(l.src[start:l.pos])
+	l.leading = false
+}
+
+// dollarQuoted scans a $tag$...$tag$ string, it returns false if there is none at the current position.
+func (l *lexer) dollarQuoted() bool {
+	end := 1
+	for l.pos+end < len(l.src) && isWordChar(l.src[l.pos+end]) && l.src[l.pos+end] != '$' {
+		end++
+	}
+	if l.pos+end >= len(l.src) || l.src[l.pos+end] != '$' || (end > 1 && isDigit(l.src[l.pos+1])) {
+		return false // e.g. the parameter $1
+	}
+	tag := l.src[l.pos : l.pos+end+1]
+	start := l.pos
+	closing := strings.Index(l.src[l.pos+len(tag):], tag)
+	if closing < 0 {
+		l.pos = len(l.src)
+	} else {
+		l.pos += len(tag) + closing + len(tag)
+	}
+	l.code.WriteString(l.src[start:l.pos])
+	l.leading = false
+	return true
+}
+
+// word scans a keyword or identifier and keeps track of blocks.
+func (l *lexer) word() {
+	start := l.pos
+	for l.pos < len(l.src) && isWordChar(l.src[l.pos]) {
+		l.pos++
+	}
+	w := l.src[start:l.pos]
+	code := l.code.String() // without the word
+	l.code.WriteString(w)
+
+	if l.d.EscapeStrings && (w == "E" || w == "e") && l.pos < len(l.src) && l.src[l.pos] == '\'' {
+		l.quoted('\'', true)
+		return
+	}
+
+	if l.d.Blocks {
+		switch strings.ToUpper(w) {
+		case "BEGIN":
+			if l.beginsBlock(code) {
+				l.depth++
+				l.cond = -1
+			}
+		case "IF", "WHILE":
+			if blockKeywords[lastToken(code)] {
+				l.cond = len(code) + len(w)
+			}
+		case "THEN", "DO":
+			l.cond = -1
+		case "CASE":
+			l.depth++
+		case "END":
+			switch l.qualifier() {
+			case "IF", "LOOP", "WHILE", "REPEAT":
+				// ends a compound statement within a block, whose start isn't tracked
+			default: // a block, or CASE, TRY and CATCH
+				if l.depth > 0 {
+					l.depth--
+				}
+			}
+		}
+	}
+	l.leading = false
+}
+
+// blockKeywords may be followed by a block, the empty token is the start of a statement.
+var blockKeywords = map[string]bool{
+	"": true, ";": true, ":": true, "BEGIN": true, "THEN": true, "ELSE": true, "DO": true, "LOOP": true,
+}
+
+// routine matches the start of a statement creating a routine, whose body may be a block.
+var routine = regexp.MustCompile(`(?i)^CREATE\s+(?:[^\s(]+\s+)*?(?:PROCEDURE|PROC|FUNCTION|TRIGGER)\s`)
+
+// beginsBlock reports whether the BEGIN just scanned, following the given code of
+// the statement, starts a block rather than a transaction, see beginsTx, or being an
+// identifier, e.g. SELECT begin FROM t. It does if it is followed by TRY or CATCH,
+// follows a keyword like THEN or the condition of an IF or WHILE, or starts the body
+// of a routine, e.g. CREATE PROCEDURE p() BEGIN or CREATE PROCEDURE p AS BEGIN.
+func (l *lexer) beginsBlock(code string) bool {
+	if l.beginsTx() {
+		return false
+	}
+	if next, _ := l.peekWord(); next == "TRY" || next == "CATCH" {
+		return true
+	}
+	if blockKeywords[lastToken(code)] {
+		return true
+	}
+	if l.cond >= 0 && !strings.Contains(code[l.cond:], l.d.Separator) {
+		return true
+	}
+	return l.depth == 0 && routine.MatchString(strings.TrimSpace(code))
+}
+
+// lastToken returns the last word of the code in upper case, or its last character
+// if it doesn't end with a word. It is empty if there is no code.
+func lastToken(code string) string {
+	code = strings.TrimRightFunc(code, unicode.IsSpace)
+	start := len(code)
+	for start > 0 && isWordChar(code[start-1]) {
+		start--
+	}
+	if start == len(code) && start > 0 {
+		start--
+	}
+	return strings.ToUpper(code[start:])
+}
+
+// beginsTx reports whether the BEGIN just scanned starts a transaction rather than
+// a block, e.g. of a trigger. It does if it is followed by the next word of a begin
+// statement of the dialect, e.g. BEGIN TRAN, or if it is leading and a begin statement
+// on its own, while T-SQL blocks like BEGIN TRY or a leading BEGIN ... END are not.
+func (l *lexer) beginsTx() bool {
+	next, _ := l.peekWord()
+	for _, b := range l.d.Begin {
+		words := strings.Fields(strings.ToUpper(b))
+		if words[0] != "BEGIN" {
+			continue
+		}
+		if len(words) == 1 && l.leading {
+			return true
+		}
+		if len(words) > 1 && words[1] == next {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifier scans the keyword qualifying the END just scanned, e.g. IF of END IF,
+// and returns it. It returns "" and scans nothing if there is none.
+func (l *lexer) qualifier() string {
+	next, end := l.peekWord()
+	switch next {
+	case "IF", "LOOP", "WHILE", "REPEAT", "CASE", "TRY", "CATCH":
+		l.code.WriteString(l.src[l.pos:end])
+		l.pos = end
+		return next
+	}
+	return ""
+}
+
+// peekWord returns the word following the current position and whitespace in upper
+// case, as well as its end. The word is empty if there is none.
+func (l *lexer) peekWord() (string, int) {
+	start := l.pos
+	for start < len(l.src) && isSpace(l.src[start]) {
+		start++
+	}
+	end := start
+	for end < len(l.src) && isWordChar(l.src[end]) {
+		end++
+	}
+	return strings.ToUpper(l.src[start:end]), end
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isWordChar(c byte) bool {
+	return isWordStart(c) || isDigit(c) || c == '$'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,289 @@
+package statement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func texts(stmts []Statement) []string {
+	t := []string{}
+	for _, s := range stmts {
+		t = append(t, s.Text)
+	}
+	return t
+}
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		description string
+		dialect     *Dialect
+		in          string
+		want        []string
+	}{
+		{
+			description: "postgres/simple",
+			dialect:     Postgres,
+			in:          "SELECT 1; SELECT 2;\nSELECT 3",
+			want:        []string{"SELECT 1", "SELECT 2", "SELECT 3"},
+		},
+		{
+			description: "postgres/quotes",
+			dialect:     Postgres,
+			in:          `INSERT INTO t VALUES ('a;b', 'it''s;', "col;umn"); SELECT E'\';';`,
+			want:        []string{`INSERT INTO t VALUES ('a;b', 'it''s;', "col;umn")`, `SELECT E'\';'`},
+		},
+		{
+			description: "postgres/comments",
+			dialect:     Postgres,
+			in:          "SELECT 1; -- comment; with separator\n/* block; /* nested; */ still comment; */ SELECT 2; -- only a comment;",
+			want:        []string{"SELECT 1", "-- comment; with separator\n/* block; /* nested; */ still comment; */ SELECT 2"},
+		},
+		{
+			description: "postgres/dollar quotes",
+			dialect:     Postgres,
+			in:          "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql; DO $body$ BEGIN PERFORM 1; END $body$; SELECT $1;",
+			want:        []string{"CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql", "DO $body$ BEGIN PERFORM 1; END $body$", "SELECT $1"},
+		},
+		{
+			description: "postgres/case",
+			dialect:     Postgres,
+			in:          "SELECT CASE WHEN a THEN 1 ELSE 2 END FROM t; SELECT 3",
+			want:        []string{"SELECT CASE WHEN a THEN 1 ELSE 2 END FROM t", "SELECT 3"},
+		},
+		{
+			description: "mysql/quotes",
+			dialect:     MySQL,
+			in:          "INSERT INTO `t;1` VALUES ('a\\';b', \"c\\\";d\"); SELECT 2",
+			want:        []string{"INSERT INTO `t;1` VALUES ('a\\';b', \"c\\\";d\")", "SELECT 2"},
+		},
+		{
+			description: "mysql/comments",
+			dialect:     MySQL,
+			in:          "SELECT 1; # comment; here\nSELECT 2 -- comment;\n; /* c; */",
+			want:        []string{"SELECT 1", "# comment; here\nSELECT 2 -- comment;"},
+		},
+		{
+			description: "mysql/compound statement",
+			dialect:     MySQL,
+			in:          "CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END; CALL p();",
+			want:        []string{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", "CALL p()"},
+		},
+		{
+			description: "mysql/compound statement with qualified ends",
+			dialect:     MySQL,
+			in:          "CREATE PROCEDURE p() BEGIN DECLARE i INT DEFAULT 0; CASE i WHEN 0 THEN SELECT 1; ELSE SELECT 2; END CASE; IF i = 0 THEN SELECT 3; END IF; l: LOOP LEAVE l; END LOOP; END; CALL p();",
+			want:        []string{"CREATE PROCEDURE p() BEGIN DECLARE i INT DEFAULT 0; CASE i WHEN 0 THEN SELECT 1; ELSE SELECT 2; END CASE; IF i = 0 THEN SELECT 3; END IF; l: LOOP LEAVE l; END LOOP; END", "CALL p()"},
+		},
+		{
+			description: "cypher/commands",
+			dialect:     Cypher,
+			in:          ":begin\nCREATE (n:Person {name: 'a;b'});\nMATCH (a)--(b) RETURN a; // comment;\n:commit",
+			want:        []string{":begin", "CREATE (n:Person {name: 'a;b'})", "MATCH (a)--(b) RETURN a", ":commit"},
+		},
+		{
+			description: "cypher/commands with separator",
+			dialect:     Cypher,
+			in:          ":begin;\nCREATE (n:`Per;son` {name: \"a\\\";b\"});\n:rollback;",
+			want:        []string{":begin", "CREATE (n:`Per;son` {name: \"a\\\";b\"})", ":rollback"},
+		},
+		{
+			description: "sqlite/trigger",
+			dialect:     SQLite,
+			in:          "CREATE TRIGGER t AFTER INSERT ON a BEGIN UPDATE b SET c = CASE WHEN 1 THEN 2 END; DELETE FROM [d;e]; END; BEGIN; END;",
+			want:        []string{"CREATE TRIGGER t AFTER INSERT ON a BEGIN UPDATE b SET c = CASE WHEN 1 THEN 2 END; DELETE FROM [d;e]; END", "BEGIN", "END"},
+		},
+		{
+			description: "mssql/block",
+			dialect:     MSSQL,
+			in:          "IF OBJECT_ID('t') IS NULL BEGIN CREATE TABLE t (id INT); INSERT INTO [t] VALUES (1); END; SELECT 1",
+			want:        []string{"IF OBJECT_ID('t') IS NULL BEGIN CREATE TABLE t (id INT); INSERT INTO [t] VALUES (1); END", "SELECT 1"},
+		},
+		{
+			description: "mssql/try catch",
+			dialect:     MSSQL,
+			in:          "BEGIN TRY\n INSERT INTO t VALUES(1);\n INSERT INTO t VALUES(2);\nEND TRY\nBEGIN CATCH\n SELECT ERROR_MESSAGE();\nEND CATCH; SELECT 1",
+			want:        []string{"BEGIN TRY\n INSERT INTO t VALUES(1);\n INSERT INTO t VALUES(2);\nEND TRY\nBEGIN CATCH\n SELECT ERROR_MESSAGE();\nEND CATCH", "SELECT 1"},
+		},
+		{
+			description: "mssql/leading block",
+			dialect:     MSSQL,
+			in:          "BEGIN INSERT INTO t VALUES (1); INSERT INTO t VALUES (2); END; BEGIN TRAN; COMMIT",
+			want:        []string{"BEGIN INSERT INTO t VALUES (1); INSERT INTO t VALUES (2); END", "BEGIN TRAN", "COMMIT"},
+		},
+		{
+			description: "mssql/transaction within a block",
+			dialect:     MSSQL,
+			in:          "IF 1 = 1 BEGIN BEGIN TRANSACTION; INSERT INTO t VALUES (1); COMMIT; END; SELECT 1",
+			want:        []string{"IF 1 = 1 BEGIN BEGIN TRANSACTION; INSERT INTO t VALUES (1); COMMIT; END", "SELECT 1"},
+		},
+		{
+			description: "postgres/begin as identifier",
+			dialect:     Postgres,
+			in:          "SELECT begin, x FROM t; SELECT 1 AS begin; SELECT 2;",
+			want:        []string{"SELECT begin, x FROM t", "SELECT 1 AS begin", "SELECT 2"},
+		},
+		{
+			description: "mysql/begin as identifier",
+			dialect:     MySQL,
+			in:          "SELECT begin, x FROM t; UPDATE t SET begin = 1 WHERE x = 2; SELECT 2;",
+			want:        []string{"SELECT begin, x FROM t", "UPDATE t SET begin = 1 WHERE x = 2", "SELECT 2"},
+		},
+		{
+			description: "mssql/nested blocks",
+			dialect:     MSSQL,
+			in:          "CREATE PROCEDURE p AS BEGIN WHILE @i < 2 BEGIN SET @i = @i + 1; END; IF @i = 2 SELECT 1; ELSE BEGIN SELECT 2; END; END; SELECT [begin] FROM t",
+			want:        []string{"CREATE PROCEDURE p AS BEGIN WHILE @i < 2 BEGIN SET @i = @i + 1; END; IF @i = 2 SELECT 1; ELSE BEGIN SELECT 2; END; END", "SELECT [begin] FROM t"},
+		},
+		{
+			description: "custom separator",
+			dialect:     &Dialect{Separator: "|", DashComments: true},
+			in:          "SELECT 'a|b' | SELECT 2; SELECT 3 |",
+			want:        []string{"SELECT 'a|b'", "SELECT 2; SELECT 3"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			assert.Equal(t, tt.want, texts(tt.dialect.Split(tt.in)))
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		dialect   *Dialect
+		in        string
+		kind      Kind
+		savepoint string
+	}{
+		{Postgres, "BEGIN", Begin, ""},
+		{Postgres, "start  transaction", Begin, ""},
+		{Postgres, "END", Commit, ""},
+		{Postgres, "ABORT", Rollback, ""},
+		{Postgres, "SAVEPOINT sp1", Savepoint, "sp1"},
+		{Postgres, "RELEASE sp1", Release, "sp1"},
+		{Postgres, "ROLLBACK TO SAVEPOINT sp1", RollbackTo, "sp1"},
+		{Postgres, "BEGIN -- comment", Begin, ""},
+		{Postgres, "BEGIN ISOLATION LEVEL SERIALIZABLE", Begin, ""},
+		{Postgres, "begin transaction read only", Begin, ""},
+		{Postgres, "BEGINNING", Plain, ""},
+		{MySQL, "START TRANSACTION", Begin, ""},
+		{MySQL, "COMMIT WORK", Commit, ""},
+		{MySQL, "ROLLBACK", Rollback, ""},
+		{MySQL, "ROLLBACK WORK TO sp1", RollbackTo, "sp1"},
+		{MySQL, "RELEASE SAVEPOINT sp1", Release, "sp1"},
+		{MySQL, "END", Plain, ""},
+		{MySQL, "START TRANSACTION READ ONLY", Begin, ""},
+		{Cypher, ":begin", Begin, ""},
+		{Cypher, ":COMMIT", Commit, ""},
+		{Cypher, ":rollback", Rollback, ""},
+		{Cypher, "BEGIN", Plain, ""},
+		{MSSQL, "BEGIN TRAN", Begin, ""},
+		{MSSQL, "BEGIN", Plain, ""},
+		{MSSQL, "BEGIN TRAN t1", Begin, ""},
+		{MSSQL, "SAVE TRANSACTION sp1", Savepoint, "sp1"},
+		{MSSQL, "ROLLBACK TRANSACTION sp1", RollbackTo, "sp1"},
+		{MSSQL, "ROLLBACK TRANSACTION", Rollback, ""},
+		{SQLite, "BEGIN IMMEDIATE", Begin, ""},
+		{SQLite, "END TRANSACTION", Commit, ""},
+	}
+
+	for _, tt := range testCases {
+		stmts := tt.dialect.Split(tt.in)
+		if assert.Len(t, stmts, 1, "%v: %v", tt.dialect.Name, tt.in) {
+			assert.Equal(t, tt.kind, stmts[0].Kind, "%v: %v", tt.dialect.Name, tt.in)
+			assert.Equal(t, tt.savepoint, stmts[0].Savepoint, "%v: %v", tt.dialect.Name, tt.in)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	d, err := Lookup("postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, Postgres, d)
+
+	_, err = Lookup("oracle")
+	assert.EqualError(t, err, `unknown dialect "oracle", available dialects: cypher, mssql, mysql, postgres, sqlite, standard`)
+}
+
+func TestBind(t *testing.T) {
+	testCases := []struct {
+		description string
+		dialect     *Dialect
+		in          string
+		args        []interface{}
+		want        []Statement
+	}{
+		{
+			description: "postgres/renumbered",
+			dialect:     Postgres,
+			in:          "INSERT INTO t VALUES ($1, '$2', $$ $3 $$); UPDATE t SET a = $3 WHERE b = $2 AND c = $3;",
+			args:        []interface{}{1, "b", 3},
+			want: []Statement{
+				{Text: "INSERT INTO t VALUES ($1, '$2', $$ $3 $$)", Args: []interface{}{1}},
+				{Text: "UPDATE t SET a = $1 WHERE b = $2 AND c = $1", Args: []interface{}{3, "b"}},
+			},
+		},
+		{
+			description: "mysql/consecutive",
+			dialect:     MySQL,
+			in:          "BEGIN; INSERT INTO t VALUES (?, '?', ?); -- ?\nSELECT ?; COMMIT;",
+			args:        []interface{}{1, 2, 3},
+			want: []Statement{
+				{Text: "BEGIN", Kind: Begin},
+				{Text: "INSERT INTO t VALUES (?, '?', ?)", Args: []interface{}{1, 2}},
+				{Text: "-- ?\nSELECT ?", Args: []interface{}{3}, Query: true},
+				{Text: "COMMIT", Kind: Commit},
+			},
+		},
+		{
+			description: "cypher/named",
+			dialect:     Cypher,
+			in:          ":begin\nCREATE (n {id: $p2, name: '$p1'});\n:commit",
+			args:        []interface{}{"a", 2},
+			want: []Statement{
+				{Text: ":begin", Kind: Begin},
+				{Text: "CREATE (n {id: $p1, name: '$p1'})", Args: []interface{}{2}},
+				{Text: ":commit", Kind: Commit},
+			},
+		},
+		{
+			description: "mssql/variables",
+			dialect:     MSSQL,
+			in:          "DECLARE @param INT = @p1; SELECT @param",
+			args:        []interface{}{1},
+			want: []Statement{
+				{Text: "DECLARE @param INT = @p1", Args: []interface{}{1}},
+				{Text: "SELECT @param", Query: true},
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.description, func(t *testing.T) {
+			got, err := tt.dialect.Bind(tt.in, tt.args)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReturnsRows(t *testing.T) {
+	testCases := []struct {
+		code string
+		want bool
+	}{
+		{"SELECT * FROM t", true},
+		{"  with x AS (SELECT 1) SELECT * FROM x", true},
+		{"INSERT INTO t VALUES (1) RETURNING id", true},
+		{"MATCH (n:Person) RETURN n", true},
+		{"INSERT INTO t SELECT * FROM s", false},
+		{"UPDATE t SET a = 1", false},
+		{"CREATE (n:Person {id: 1})", false},
+	}
+
+	for _, tt := range testCases {
+		assert.Equal(t, tt.want, returnsRows(tt.code), tt.code)
+	}
+}